@@ -25,13 +25,15 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	// Close sends the socket.io disconnect and waits for the client to shut down.
+	defer client.Close()
 
 	// This sends a request to start streaming actions.
 	//    See also: stream.NewActionsReqByBlock and stream.NewActionsReqByTime.
 	//
-	// This library imposes an arbitrary limit of one subscription per client.
-	// If another request has already been sent on this client,
-	// it will return an error.
+	// Several requests can share a client, see client.SubscribeActions and
+	// client.SubscribeDeltas for routing each to its own channel. Sending an
+	// identical request twice will return an error.
 	err = client.StreamActions(stream.NewActionsReq(contract, account, action))
 	if err != nil {
 		panic(err)
@@ -25,12 +25,14 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	// Close sends the socket.io disconnect and waits for the client to shut down.
+	defer client.Close()
 
 	// This sends a request to start streaming table deltas.
 	//    See also: stream.NewDeltasReqByBlock and stream.NewDeltasReqByTime.
 	//
-	// This library imposes an arbitrary limit of one subscription per client. If another request has already been
-	// sent on this client, it will return an error.
+	// Several requests can share a client, see client.SubscribeActions and client.SubscribeDeltas for routing each to
+	// its own channel. Sending an identical request twice will return an error.
 	err = client.StreamDeltas(stream.NewDeltasReq(code, table, scope, payer))
 	if err != nil {
 		panic(err)
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	stream "github.com/blockpane/go-hyperion-stream"
+	"github.com/eoscanada/eos-go"
+	"log"
+)
+
+var (
+	url      = "wss://wax.eosrio.io"
+	contract = "m.federation"
+	action   = "logmine"
+	account  = ""
+)
+
+// LogMine is the data of the m.federation::logmine action, only the fields used are needed.
+type LogMine struct {
+	Miner      eos.AccountName `json:"miner"`
+	Bounty     eos.Asset       `json:"bounty"`
+	PlanetName eos.Name        `json:"planet_name"`
+	LandId     eos.Uint64      `json:"land_id"`
+}
+
+func main() {
+	// traces are passed to the handler, so no results channel is needed: with a nil channel anything that isn't
+	// subscribed to is discarded rather than blocking delivery to the handler.
+	errors := make(chan error)
+
+	client, err := stream.NewClient(url, nil, errors)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	// the handler is called with each logmine action decoded into a LogMine, returning an error
+	// unsubscribes.
+	_, err = stream.Subscribe(context.Background(), client, stream.NewActionsReq(contract, account, action),
+		func(act *stream.TypedAction[LogMine]) error {
+			log.Printf("%13s <- %11v %-13s - %v\n", act.Data.Miner, act.Data.Bounty, act.Data.PlanetName, act.Data.LandId)
+			return nil
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	for {
+		select {
+		case <-client.Ctx.Done():
+			return
+		case e := <-errors:
+			log.Println(e)
+		}
+	}
+}
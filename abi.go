@@ -0,0 +1,479 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/eoscanada/eos-go"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AbiRegistry holds contract ABIs, keyed by account and the abi_sequence of the setabi that installed them. See
+// WithAbiRegistry.
+type AbiRegistry struct {
+	mux  sync.RWMutex
+	abis map[eos.AccountName]map[uint32]*eos.ABI
+}
+
+// NewAbiRegistry returns an empty AbiRegistry.
+func NewAbiRegistry() *AbiRegistry {
+	return &AbiRegistry{abis: make(map[eos.AccountName]map[uint32]*eos.ABI)}
+}
+
+// Add registers the ABI for account as of sequence, the account's abi_sequence once the ABI was set. A sequence of
+// zero is used for action traces with an abi_sequence that has no ABI of its own, which is useful when the ABI is
+// known not to have changed in ways that matter.
+func (r *AbiRegistry) Add(account eos.AccountName, sequence uint32, abi *eos.ABI) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.abis[account] == nil {
+		r.abis[account] = make(map[uint32]*eos.ABI)
+	}
+	r.abis[account][sequence] = abi
+}
+
+// AddFile registers an ABI read from a JSON file, see Add. The file may contain the ABI itself, or the response of
+// the get_abi API which wraps it in an "abi" field.
+func (r *AbiRegistry) AddFile(account eos.AccountName, sequence uint32, path string) error {
+	b, err := os.ReadFile(path) // #nosec G304 -- reading the ABI the caller asked for
+	if err != nil {
+		return err
+	}
+	var wrapped struct {
+		Abi *eos.ABI `json:"abi"`
+	}
+	if err = json.Unmarshal(b, &wrapped); err == nil && wrapped.Abi != nil {
+		r.Add(account, sequence, wrapped.Abi)
+		return nil
+	}
+	abi, err := eos.NewABI(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	r.Add(account, sequence, abi)
+	return nil
+}
+
+// lookup returns the ABI for an account's abi_sequence, falling back to the unversioned ABI. A sequence of zero
+// returns the latest ABI. known is false if the account has no ABIs at all.
+func (r *AbiRegistry) lookup(account eos.AccountName, sequence uint32) (abi *eos.ABI, known bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	versions := r.abis[account]
+	if len(versions) == 0 {
+		return nil, false
+	}
+	if sequence == 0 {
+		latest := make([]uint32, 0, len(versions))
+		for s := range versions {
+			latest = append(latest, s)
+		}
+		sort.Slice(latest, func(i, j int) bool { return latest[i] > latest[j] })
+		return versions[latest[0]], true
+	}
+	if abi = versions[sequence]; abi == nil {
+		abi = versions[0]
+	}
+	return abi, true
+}
+
+// WithAbiRegistry normalizes the data of traces from contracts in the registry according to their ABI, and reports
+// an AbiMismatchError for any trace whose data doesn't match, which is still delivered unchanged.
+//
+// Integers and floats become json.Number without losing precision whether Hyperion sent them as numbers or strings,
+// assets and symbols are put in their canonical form, and Act.RawData or DeltaTrace.RawData is replaced so that
+// DecodeData sees the normalized data. Action traces use the ABI matching their AbiSequence, and deltas the latest ABI.
+func WithAbiRegistry(r *AbiRegistry) Option {
+	return func(c *Client) {
+		c.abis = r
+	}
+}
+
+// normalize applies the ABI registry to decoded traces.
+func (c *Client) normalize(responses []HyperionResponse) {
+	for _, resp := range responses {
+		var err error
+		switch r := resp.(type) {
+		case *ActionTrace:
+			err = c.abis.normalizeAction(r)
+		case *DeltaTrace:
+			err = c.abis.normalizeDelta(r)
+		}
+		if err != nil {
+			c.report(err)
+		}
+	}
+}
+
+func (r *AbiRegistry) normalizeAction(a *ActionTrace) error {
+	abi, known := r.lookup(a.Act.Account, a.AbiSequence)
+	if !known {
+		return nil
+	}
+	mismatch := AbiMismatchError{Account: a.Act.Account, Name: string(a.Act.Name), AbiSequence: a.AbiSequence, GlobalSequence: a.GlobalSequence}
+	if abi == nil {
+		mismatch.Reason = "no ABI registered for this abi_sequence"
+		return mismatch
+	}
+	action := abi.ActionForName(a.Act.Name)
+	if action == nil {
+		mismatch.Reason = "action is not in the ABI"
+		return mismatch
+	}
+	data, raw, err := normalizeRaw(abi, action.Type, a.Act.RawData, a.Act.Data)
+	if err != nil {
+		return mismatch.with(err)
+	}
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		mismatch.Reason = "action data is not an object"
+		return mismatch
+	}
+	a.Act.Data, a.Act.RawData = m, raw
+	return nil
+}
+
+func (r *AbiRegistry) normalizeDelta(d *DeltaTrace) error {
+	abi, known := r.lookup(d.Code, 0)
+	if !known {
+		return nil
+	}
+	mismatch := AbiMismatchError{Account: d.Code, Name: string(d.Table)}
+	table := abi.TableForName(eos.TableName(d.Table))
+	if table == nil {
+		mismatch.Reason = "table is not in the ABI"
+		return mismatch
+	}
+	data, raw, err := normalizeRaw(abi, table.Type, d.RawData, d.Data)
+	if err != nil {
+		return mismatch.with(err)
+	}
+	d.Data, d.RawData = data, raw
+	return nil
+}
+
+// normalizeRaw decodes the raw JSON keeping numbers intact, or re-encodes data if the trace was not built from JSON,
+// and normalizes it as the ABI type.
+func normalizeRaw(abi *eos.ABI, typeName string, raw json.RawMessage, data interface{}) (interface{}, json.RawMessage, error) {
+	var err error
+	if len(raw) == 0 {
+		if raw, err = json.Marshal(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err = dec.Decode(&v); err != nil {
+		return nil, nil, err
+	}
+	n := abiNormalizer{abi: abi}
+	if v, err = n.value(typeName, v, ""); err != nil {
+		return nil, nil, err
+	}
+	if raw, err = json.Marshal(v); err != nil {
+		return nil, nil, err
+	}
+	return v, raw, nil
+}
+
+// abiNormalizer walks decoded JSON alongside the ABI's types.
+type abiNormalizer struct {
+	abi   *eos.ABI
+	depth int
+}
+
+// maxAbiDepth stops a recursive ABI from looping forever.
+const maxAbiDepth = 64
+
+// fieldError is a mismatch at a field of the data.
+type fieldError struct {
+	field  string
+	reason string
+}
+
+func (f fieldError) Error() string {
+	return f.field + ": " + f.reason
+}
+
+func (n *abiNormalizer) value(typeName string, v interface{}, field string) (interface{}, error) {
+	if n.depth++; n.depth > maxAbiDepth {
+		return nil, fieldError{field, "ABI types are nested too deeply"}
+	}
+	defer func() { n.depth-- }()
+
+	switch {
+	case strings.HasSuffix(typeName, "$"):
+		return n.value(strings.TrimSuffix(typeName, "$"), v, field)
+	case strings.HasSuffix(typeName, "?"):
+		if v == nil {
+			return nil, nil
+		}
+		return n.value(strings.TrimSuffix(typeName, "?"), v, field)
+	case strings.HasSuffix(typeName, "[]"):
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fieldError{field, "expected an array of " + strings.TrimSuffix(typeName, "[]")}
+		}
+		out := make([]interface{}, len(list))
+		for i := range list {
+			var err error
+			if out[i], err = n.value(strings.TrimSuffix(typeName, "[]"), list[i], fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	if resolved, alias := n.abi.TypeNameForNewTypeName(typeName); alias {
+		return n.value(resolved, v, field)
+	}
+	if s := n.abi.StructForName(typeName); s != nil {
+		return n.object(s, v, field)
+	}
+	if variant := n.abi.VariantForName(typeName); variant != nil {
+		pair, ok := v.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fieldError{field, "expected a [type, value] pair for variant " + typeName}
+		}
+		name, _ := pair[0].(string)
+		if !isVariantType(variant, name) {
+			return nil, fieldError{field, fmt.Sprintf("%q is not a type of variant %s", name, typeName)}
+		}
+		inner, err := n.value(name, pair[1], field)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{name, inner}, nil
+	}
+	return builtin(typeName, v, field)
+}
+
+// object normalizes a struct including the fields of its base, any field missing from the data must be a binary
+// extension, and fields not in the ABI are a mismatch.
+func (n *abiNormalizer) object(s *eos.StructDef, v interface{}, field string) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fieldError{field, "expected an object for " + s.Name}
+	}
+	fields := s.Fields
+	for base := s.Base; base != ""; {
+		b := n.abi.StructForName(base)
+		if b == nil {
+			return nil, fieldError{field, "unknown base struct " + base}
+		}
+		fields = append(append([]eos.FieldDef{}, b.Fields...), fields...)
+		base = b.Base
+	}
+
+	out := make(map[string]interface{}, len(m))
+	for _, f := range fields {
+		path := f.Name
+		if field != "" {
+			path = field + "." + f.Name
+		}
+		fv, present := m[f.Name]
+		if !present {
+			if strings.HasSuffix(f.Type, "$") {
+				continue
+			}
+			return nil, fieldError{path, "missing"}
+		}
+		var err error
+		if out[f.Name], err = n.value(f.Type, fv, path); err != nil {
+			return nil, err
+		}
+	}
+	for k := range m {
+		if !hasField(fields, k) {
+			path := k
+			if field != "" {
+				path = field + "." + k
+			}
+			return nil, fieldError{path, "not in the ABI"}
+		}
+	}
+	return out, nil
+}
+
+func isVariantType(variant *eos.VariantDef, name string) bool {
+	for _, t := range variant.Types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasField(fields []eos.FieldDef, name string) bool {
+	for _, f := range fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// integerBits is the size of each ABI integer type, negative for signed types.
+var integerBits = map[string]int{
+	"int8": -8, "int16": -16, "int32": -32, "int64": -64, "int128": -128, "varint32": -32,
+	"uint8": 8, "uint16": 16, "uint32": 32, "uint64": 64, "uint128": 128, "varuint32": 32,
+}
+
+// builtin normalizes the ABI's built in types.
+func builtin(typeName string, v interface{}, field string) (interface{}, error) {
+	if bits, ok := integerBits[typeName]; ok {
+		return integer(typeName, bits, v, field)
+	}
+	switch typeName {
+	case "bool":
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case json.Number:
+			if b == "0" || b == "1" {
+				return b == "1", nil
+			}
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fieldError{field, fmt.Sprintf("%v is not a bool", v)}
+	case "float32", "float64":
+		s, ok := numberString(v)
+		if ok {
+			size := 64
+			if typeName == "float32" {
+				size = 32
+			}
+			if _, err := strconv.ParseFloat(s, size); err == nil {
+				return json.Number(s), nil
+			}
+		}
+		return nil, fieldError{field, fmt.Sprintf("%v is not a %s", v, typeName)}
+	case "asset":
+		s, _ := v.(string)
+		asset, err := eos.NewAssetFromString(s)
+		if err != nil || s == "" {
+			return nil, fieldError{field, fmt.Sprintf("%v is not an asset", v)}
+		}
+		return asset.String(), nil
+	case "symbol":
+		s, _ := v.(string)
+		symbol, err := eos.StringToSymbol(s)
+		if err != nil {
+			return nil, fieldError{field, fmt.Sprintf("%v is not a symbol", v)}
+		}
+		return fmt.Sprintf("%d,%s", symbol.Precision, symbol.Symbol), nil
+	case "extended_asset":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fieldError{field, "expected an object for extended_asset"}
+		}
+		quantity, err := builtin("asset", m["quantity"], field+".quantity")
+		if err != nil {
+			return nil, err
+		}
+		contract, err := builtin("name", m["contract"], field+".contract")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"quantity": quantity, "contract": contract}, nil
+	case "name":
+		s, ok := v.(string)
+		if !ok || !validName(s) {
+			return nil, fieldError{field, fmt.Sprintf("%v is not a name", v)}
+		}
+		return s, nil
+	case "string", "symbol_code", "bytes", "checksum160", "checksum256", "checksum512", "public_key", "signature",
+		"time_point", "time_point_sec", "block_timestamp_type":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fieldError{field, fmt.Sprintf("%v is not a %s", v, typeName)}
+		}
+		return s, nil
+	}
+	return nil, fieldError{field, "unknown type " + typeName}
+}
+
+// integer normalizes an integer sent as either a number or a string, checking it fits the type.
+func integer(typeName string, bits int, v interface{}, field string) (interface{}, error) {
+	s, ok := numberString(v)
+	i, valid := new(big.Int).SetString(s, 10)
+	if !ok || !valid {
+		return nil, fieldError{field, fmt.Sprintf("%v is not a %s", v, typeName)}
+	}
+	min, max := new(big.Int), new(big.Int)
+	if bits < 0 {
+		max.Lsh(big.NewInt(1), uint(-bits-1))
+		min.Neg(max)
+	} else {
+		max.Lsh(big.NewInt(1), uint(bits))
+	}
+	if i.Cmp(min) < 0 || i.Cmp(max) >= 0 {
+		return nil, fieldError{field, fmt.Sprintf("%v is out of range for %s", v, typeName)}
+	}
+	return json.Number(i.String()), nil
+}
+
+// numberString returns a number sent as either a JSON number or a string.
+func numberString(v interface{}) (string, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String(), true
+	case string:
+		return n, n != ""
+	}
+	return "", false
+}
+
+// validName checks an account or action name is up to 13 characters from a-z, 1-5 and '.'.
+func validName(s string) bool {
+	if len(s) > 13 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '1' || r > '5') && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// AbiMismatchError is reported when a trace's data does not match the ABI in the AbiRegistry. Name is the action or
+// table, and AbiSequence and GlobalSequence are only set for actions.
+type AbiMismatchError struct {
+	Account        eos.AccountName
+	Name           string
+	AbiSequence    uint32
+	GlobalSequence uint64
+	Field          string
+	Reason         string
+}
+
+// with sets the field and reason from a normalization error.
+func (am AbiMismatchError) with(err error) AbiMismatchError {
+	if fe, ok := err.(fieldError); ok {
+		am.Field, am.Reason = fe.field, fe.reason
+		return am
+	}
+	am.Reason = err.Error()
+	return am
+}
+
+// Error satisfies the error interface
+func (am AbiMismatchError) Error() string {
+	where := fmt.Sprintf("%s::%s", am.Account, am.Name)
+	if am.GlobalSequence > 0 {
+		where += fmt.Sprintf(" (global sequence %d, abi sequence %d)", am.GlobalSequence, am.AbiSequence)
+	}
+	if am.Field != "" {
+		return fmt.Sprintf("data for %s does not match the ABI: %s: %s", where, am.Field, am.Reason)
+	}
+	return fmt.Sprintf("data for %s does not match the ABI: %s", where, am.Reason)
+}
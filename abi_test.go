@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/eoscanada/eos-go"
+	"testing"
+	"time"
+)
+
+func tokenRegistry(t *testing.T) *AbiRegistry {
+	t.Helper()
+	r := NewAbiRegistry()
+	if err := r.AddFile("eosio.token", 0, "testdata/eosio.token.abi.json"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestAbiNormalizeAction(t *testing.T) {
+	r := tokenRegistry(t)
+	for _, tc := range []struct {
+		name  string
+		data  string
+		field string
+		want  map[string]interface{}
+	}{
+		{
+			name: "transfer",
+			data: `{"from":"alice","to":"bob","quantity":"1.5000 EOS","memo":"hi"}`,
+			want: map[string]interface{}{"from": "alice", "to": "bob", "quantity": "1.5000 EOS", "memo": "hi"},
+		},
+		{
+			name: "open",
+			data: `{"owner":"alice","symbol":"4,EOS","ram_payer":"bob"}`,
+			want: map[string]interface{}{"owner": "alice", "symbol": "4,EOS", "ram_payer": "bob"},
+		},
+		{name: "transfer", data: `{"from":"alice","to":"bob","quantity":"lots","memo":""}`, field: "quantity"},
+		{name: "transfer", data: `{"from":"alice","to":"bob","quantity":"1.0000 EOS"}`, field: "memo"},
+		{name: "transfer", data: `{"from":"Alice!","to":"bob","quantity":"1.0000 EOS","memo":""}`, field: "from"},
+		{name: "transfer", data: `{"from":"alice","to":"bob","quantity":"1.0000 EOS","memo":"","extra":1}`, field: "extra"},
+	} {
+		a := &ActionTrace{GlobalSequence: 7}
+		if err := json.Unmarshal([]byte(`{"act":{"account":"eosio.token","name":"`+tc.name+`","data":`+tc.data+`}}`), a); err != nil {
+			t.Fatal(err)
+		}
+		err := r.normalizeAction(a)
+		if tc.field != "" {
+			var mismatch AbiMismatchError
+			if !errors.As(err, &mismatch) || mismatch.Field != tc.field || mismatch.GlobalSequence != 7 {
+				t.Errorf("%s: expected a mismatch at %s, got %v", tc.data, tc.field, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.data, err)
+			continue
+		}
+		for k, v := range tc.want {
+			if a.Act.Data[k] != v {
+				t.Errorf("%s: expected %s to be %v, got %v", tc.data, k, v, a.Act.Data[k])
+			}
+		}
+	}
+}
+
+func TestAbiNormalizeIntegers(t *testing.T) {
+	abi := &eos.ABI{
+		Structs: []eos.StructDef{
+			{Name: "base", Fields: []eos.FieldDef{{Name: "id", Type: "uint64"}}},
+			{Name: "mine", Base: "base", Fields: []eos.FieldDef{
+				{Name: "small", Type: "int8"},
+				{Name: "ratio", Type: "float64"},
+				{Name: "ids", Type: "uint64[]"},
+				{Name: "note", Type: "string?"},
+				{Name: "flag", Type: "bool$"},
+			}},
+		},
+		Actions: []eos.ActionDef{{Name: "mine", Type: "mine"}},
+	}
+	r := NewAbiRegistry()
+	r.Add("m.federation", 3, abi)
+
+	a := &ActionTrace{AbiSequence: 3}
+	a.Act.Account = "m.federation"
+	a.Act.Name = "mine"
+	a.Act.RawData = json.RawMessage(`{"id":"18446744073709551615","small":-128,"ratio":"0.5","ids":[1,"2"],"note":null}`)
+	if err := r.normalizeAction(a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Act.Data["id"] != json.Number("18446744073709551615") || a.Act.Data["small"] != json.Number("-128") {
+		t.Errorf("integers should be kept exactly: %v", a.Act.Data)
+	}
+	if string(a.Act.RawData) != `{"id":18446744073709551615,"ids":[1,2],"note":null,"ratio":0.5,"small":-128}` {
+		t.Errorf("unexpected raw data: %s", a.Act.RawData)
+	}
+	var decoded struct {
+		Id  uint64   `json:"id"`
+		Ids []uint64 `json:"ids"`
+	}
+	if err := a.DecodeData(&decoded); err != nil || decoded.Id != 18446744073709551615 || len(decoded.Ids) != 2 {
+		t.Errorf("the normalized data should decode into plain integers: %+v %v", decoded, err)
+	}
+
+	a.Act.RawData = json.RawMessage(`{"id":1,"small":128,"ratio":0,"ids":[],"note":null}`)
+	var mismatch AbiMismatchError
+	if err := r.normalizeAction(a); !errors.As(err, &mismatch) || mismatch.Field != "small" {
+		t.Errorf("expected int8 to be out of range, got %v", err)
+	}
+
+	// there is no ABI for another sequence, or an unversioned one to fall back to:
+	a.AbiSequence = 4
+	if err := r.normalizeAction(a); !errors.As(err, &mismatch) || mismatch.AbiSequence != 4 {
+		t.Errorf("expected a mismatch for an unknown abi sequence, got %v", err)
+	}
+}
+
+func TestAbiNormalizeDelta(t *testing.T) {
+	r := tokenRegistry(t)
+	d := &DeltaTrace{}
+	if err := json.Unmarshal([]byte(`{"code":"eosio.token","table":"stat","data":{"supply":"10.0000 EOS","max_supply":"100.0000 EOS","issuer":"eosio"}}`), d); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.normalizeDelta(d); err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := d.Data.(map[string]interface{}); row["issuer"] != "eosio" {
+		t.Errorf("unexpected row: %v", d.Data)
+	}
+
+	d = &DeltaTrace{Code: "eosio.token", Table: "accounts", Data: "0a0b0c"}
+	if err := r.normalizeDelta(d); !errors.As(err, new(AbiMismatchError)) {
+		t.Errorf("a row Hyperion could not deserialize should not match, got %v", err)
+	}
+	d = &DeltaTrace{Code: "other", Table: "accounts", Data: "0a0b0c"}
+	if err := r.normalizeDelta(d); err != nil {
+		t.Errorf("contracts without an ABI should be ignored, got %v", err)
+	}
+}
+
+func TestWithAbiRegistry(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithAbiRegistry(tokenRegistry(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := &ActionTrace{BlockNum: 1, GlobalSequence: 1}
+	trace.Act.Account = "eosio.token"
+	trace.Act.Name = "transfer"
+	trace.Act.Data = map[string]interface{}{"from": "alice", "to": "bob", "quantity": "1.0000", "memo": ""}
+	fc.send(t, traceFrame(t, "action_trace", RespModeLive, trace))
+	select {
+	case err = <-errs:
+		var mismatch AbiMismatchError
+		if !errors.As(err, &mismatch) || mismatch.Field != "quantity" {
+			t.Errorf("expected a mismatch for the quantity, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an AbiMismatchError")
+	}
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Act.Data["quantity"] != "1.0000" {
+		t.Errorf("a trace that doesn't match should be delivered unchanged, got %v", a.Act.Data)
+	}
+}
@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// defaultAckTimeout is how long StreamActions and StreamDeltas wait for Hyperion to acknowledge a request.
+const defaultAckTimeout = 10 * time.Second
+
+// WithAckTimeout sets how long StreamActions and StreamDeltas wait for Hyperion to acknowledge a request, the
+// default is 10 seconds. SubscribeActions and SubscribeDeltas use the supplied context instead.
+func WithAckTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.ackTimeout = d
+	}
+}
+
+// StartBlock is the block Hyperion reported it would start streaming from when it acknowledged the request, it is
+// zero if Hyperion did not include one. It is updated when the Subscription is resent after a reconnect.
+func (s *Subscription) StartBlock() uint32 {
+	return atomic.LoadUint32(&s.startBlock)
+}
+
+// streamAck is Hyperion's reply to a stream request.
+type streamAck struct {
+	status     string
+	message    string
+	startBlock uint32
+}
+
+// parseAck decodes a socket.io ack packet, which is "43" followed by the ack id and a JSON array of arguments.
+func parseAck(m []byte) (id uint64, ack streamAck, err error) {
+	body := bytes.TrimPrefix(m, []byte("43"))
+	i := bytes.IndexByte(body, '[')
+	if i < 1 {
+		return 0, ack, fmt.Errorf("invalid ack: %q", m)
+	}
+	id, err = strconv.ParseUint(string(body[:i]), 10, 64)
+	if err != nil {
+		return 0, ack, fmt.Errorf("invalid ack id: %q", m)
+	}
+
+	args := make([]interface{}, 0)
+	if err = json.Unmarshal(body[i:], &args); err != nil {
+		return 0, ack, err
+	}
+	if len(args) == 0 {
+		return id, ack, nil
+	}
+	switch reply := args[0].(type) {
+	case string:
+		ack.status = reply
+	case map[string]interface{}:
+		ack.status, _ = reply["status"].(string)
+		for _, k := range []string{"error", "message", "msg"} {
+			if msg, ok := reply[k].(string); ok {
+				ack.message = msg
+				break
+			}
+		}
+		for _, k := range []string{"startingBlock", "start_block", "starting_block"} {
+			switch n := reply[k].(type) {
+			case float64:
+				ack.startBlock = uint32(n)
+			case string:
+				block, _ := strconv.ParseUint(n, 10, 32)
+				ack.startBlock = uint32(block)
+			}
+		}
+	}
+	return id, ack, nil
+}
+
+// handleAck matches Hyperion's reply to the Subscription it acknowledges. A rejected request that nobody is waiting
+// on, which happens when resubscribing after a reconnect, is closed and reported over the errors channel.
+func (c *Client) handleAck(m []byte) {
+	id, ack, err := parseAck(m)
+	if err != nil {
+		c.report(err)
+		return
+	}
+
+	c.mux.Lock()
+	s := c.pending[id]
+	delete(c.pending, id)
+	if s == nil {
+		c.mux.Unlock()
+		return
+	}
+	if ack.status != "OK" {
+		err = StreamRequestError{SubscriptionID: s.ID, Status: ack.status, Message: ack.message}
+	} else {
+		atomic.StoreUint32(&s.startBlock, ack.startBlock)
+	}
+	waiting := s.waiting
+	if !waiting && err != nil {
+		s.closed = true
+	}
+	c.mux.Unlock()
+
+	switch {
+	case waiting:
+		s.acked <- err
+	case err != nil:
+		c.report(err)
+	}
+}
+
+// failAcks abandons requests that were waiting on an ack when the websocket failed.
+func (c *Client) failAcks(err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for id, s := range c.pending {
+		delete(c.pending, id)
+		if s.waiting {
+			s.acked <- err
+		}
+	}
+}
+
+// StreamRequestError is returned when Hyperion rejects a stream request, Status and Message are as sent by Hyperion.
+type StreamRequestError struct {
+	SubscriptionID uint64
+	Status         string
+	Message        string
+}
+
+// Error satisfies the error interface
+func (s StreamRequestError) Error() string {
+	if s.Message == "" {
+		return fmt.Sprintf("stream request %d rejected: %s", s.SubscriptionID, s.Status)
+	}
+	return fmt.Sprintf("stream request %d rejected: %s: %s", s.SubscriptionID, s.Status, s.Message)
+}
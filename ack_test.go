@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseAck(t *testing.T) {
+	for _, tc := range []struct {
+		frame  string
+		id     uint64
+		status string
+		msg    string
+		block  uint32
+		err    bool
+	}{
+		{frame: `430[{"status":"OK","startingBlock":123}]`, id: 0, status: "OK", block: 123},
+		{frame: `4312[{"status":"OK","start_block":"456"}]`, id: 12, status: "OK", block: 456},
+		{frame: `431[{"status":"FAILED","error":"invalid contract"}]`, id: 1, status: "FAILED", msg: "invalid contract"},
+		{frame: `432["OK"]`, id: 2, status: "OK"},
+		{frame: `43[{"status":"OK"}]`, err: true},
+		{frame: `43x[{"status":"OK"}]`, err: true},
+		{frame: `431[{"status":`, err: true},
+	} {
+		id, ack, err := parseAck([]byte(tc.frame))
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.frame)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.frame, err)
+			continue
+		}
+		if id != tc.id || ack.status != tc.status || ack.message != tc.msg || ack.startBlock != tc.block {
+			t.Errorf("%s: got id %d %+v", tc.frame, id, ack)
+		}
+	}
+}
+
+func TestStreamRequestAck(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.ack = func(event string, body string) string {
+		if event == "delta_stream_request" {
+			return `{"status":"ERROR","error":"rate limited"}`
+		}
+		return `{"status":"OK","startingBlock":42}`
+	}
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	sub, err := c.SubscribeActions(context.Background(), NewActionsReq("eosio.token", "", "transfer"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.StartBlock() != 42 {
+		t.Errorf("expected start block 42, got %d", sub.StartBlock())
+	}
+
+	_, err = c.SubscribeDeltas(context.Background(), NewDeltasReq("eosio.token", "accounts", "", ""), nil)
+	reqErr := StreamRequestError{}
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected StreamRequestError, got %v", err)
+	}
+	if reqErr.Status != "ERROR" || reqErr.Message != "rate limited" {
+		t.Errorf("incorrect error %+v", reqErr)
+	}
+	c.mux.Lock()
+	if len(c.subs) != 1 {
+		t.Error("rejected subscription should be removed")
+	}
+	c.mux.Unlock()
+}
+
+func TestStreamRequestAckTimeout(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.ack = func(string, string) string {
+		return ""
+	}
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithAckTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	c.mux.Lock()
+	if len(c.subs) != 0 || len(c.pending) != 0 {
+		t.Error("unacknowledged subscription should be removed")
+	}
+	c.mux.Unlock()
+}
+
+func TestStreamRequestError(t *testing.T) {
+	if (StreamRequestError{}).Error() == "" || (StreamRequestError{Message: "a"}).Error() == "" {
+		t.Error("err is empty")
+	}
+}
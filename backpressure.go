@@ -0,0 +1,322 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// BackpressurePolicy decides what happens to messages from Hyperion when the consumer falls behind.
+type BackpressurePolicy uint8
+
+const (
+	// PolicyBlock stops reading from the websocket until the queue has space. Hyperion's pings go unanswered while
+	// blocked, so a consumer that stalls for longer than the ping timeout will cause the websocket to fail.
+	PolicyBlock BackpressurePolicy = iota
+	// PolicyDropOldest discards the oldest queued trace to make room.
+	PolicyDropOldest
+	// PolicyDropNewest discards the trace that did not fit.
+	PolicyDropNewest
+	// PolicySpill writes messages that don't fit to a file, they are read back in order once the queue drains.
+	PolicySpill
+)
+
+// defaultQueueSize is the Backpressure.Size used by the policies other than PolicyBlock when it is less than one.
+const defaultQueueSize = 1024
+
+// Backpressure configures a bounded queue between the websocket and the consumer, see WithBackpressure. Size is how
+// many messages are held in memory, which defaults to 1024 for the policies other than PolicyBlock. Dir is the
+// directory used for spill files with PolicySpill, which defaults to os.TempDir.
+type Backpressure struct {
+	Policy BackpressurePolicy
+	Size   int
+	Dir    string
+}
+
+// WithBackpressure bounds how many messages are held while the consumer is busy. Without it each message is decoded
+// and delivered on its own goroutine, so a slow consumer causes unbounded growth in goroutines and memory.
+// Acknowledgements and pings are handled before the queue, and only trace messages are dropped: control events such
+// as lib_update and fork_event are always queued. Client.Stats counts the messages that were dropped or spilled.
+func WithBackpressure(b Backpressure) Option {
+	return func(c *Client) {
+		switch {
+		case b.Policy != PolicyBlock && b.Size < 1:
+			b.Size = defaultQueueSize
+		case b.Size < 0:
+			b.Size = 0
+		}
+		c.queue = &frameQueue{Backpressure: b, ready: make(chan struct{}, 1), blocking: make(chan []byte, b.Size)}
+	}
+}
+
+// Stats counts messages and errors that were not delivered directly because the consumer fell behind. Dropped and
+// Spilled are always zero without WithBackpressure, ErrorsDropped counts errors that didn't fit in the error buffer.
+type Stats struct {
+	Dropped       uint64
+	Spilled       uint64
+	ErrorsDropped uint64
+}
+
+// Stats returns the Client's backpressure counters.
+func (c *Client) Stats() Stats {
+	stats := Stats{ErrorsDropped: c.errorsDropped.Load()}
+	if c.queue != nil {
+		stats.Dropped = c.queue.dropped.Load()
+		stats.Spilled = c.queue.spilled.Load()
+	}
+	return stats
+}
+
+// frameQueue holds raw messages between the websocket reader and a single goroutine that decodes them.
+type frameQueue struct {
+	Backpressure
+
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+
+	// blocking is the queue for PolicyBlock.
+	blocking chan []byte
+
+	// the other policies share a slice guarded by mux, and signal ready when it becomes non-empty.
+	mux    sync.Mutex
+	frames [][]byte
+	ready  chan struct{}
+	spill  *spillFile
+	// overflow holds control events that could not be written to the spill file, which are delivered after it.
+	overflow [][]byte
+}
+
+// push queues a message, applying the policy to traces if the queue is full. Control events are queued even when it
+// is full, or spilled with the traces while spilling so their order is kept. It returns false if the Client was
+// cancelled.
+func (q *frameQueue) push(c *Client, m []byte) bool {
+	if q.Policy == PolicyBlock {
+		select {
+		case q.blocking <- m:
+			return true
+		case <-c.Ctx.Done():
+			return false
+		}
+	}
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	trace := isTrace(m)
+	switch {
+	case len(q.overflow) > 0:
+		// nothing may be queued ahead of control events that are waiting for the spill file to drain:
+		if trace {
+			q.dropped.Add(1)
+		} else {
+			q.overflow = append(q.overflow, m)
+		}
+	case q.spill != nil && q.spill.pending > 0:
+		// once spilling, everything goes to disk until it drains so order is kept:
+		q.spillFrame(c, m, trace)
+	case len(q.frames) < q.Size || !trace:
+		q.frames = append(q.frames, m)
+	case q.Policy == PolicyDropOldest:
+		q.dropOldest()
+		q.frames = append(q.frames, m)
+	case q.Policy == PolicySpill:
+		q.spillFrame(c, m, trace)
+	default:
+		q.dropped.Add(1)
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// dropOldest discards the oldest queued trace, control events are kept. The caller must hold q.mux.
+func (q *frameQueue) dropOldest() {
+	for i, m := range q.frames {
+		if isTrace(m) {
+			copy(q.frames[i:], q.frames[i+1:])
+			q.frames[len(q.frames)-1] = nil
+			q.frames = q.frames[:len(q.frames)-1]
+			q.dropped.Add(1)
+			return
+		}
+	}
+}
+
+// isTrace reports whether a message is a trace sent as a "message" event, which is the only kind the policies may
+// drop.
+func isTrace(m []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(m[2:], "0123456789"), []byte(`["message"`))
+}
+
+// spillFrame writes a message to the spill file. If that fails the error is reported and a trace is dropped, while a
+// control event is held in memory after everything already spilled.
+func (q *frameQueue) spillFrame(c *Client, m []byte, trace bool) {
+	var err error
+	if q.spill == nil {
+		q.spill, err = newSpillFile(q.Dir)
+	}
+	if err == nil {
+		err = q.spill.write(m)
+	}
+	if err != nil {
+		switch {
+		case trace:
+			q.dropped.Add(1)
+		case q.spill != nil && q.spill.pending > 0:
+			q.overflow = append(q.overflow, m)
+		default:
+			q.frames = append(q.frames, m)
+		}
+		c.goroutine(func() {
+			c.report(err)
+		})
+		return
+	}
+	q.spilled.Add(1)
+}
+
+// pop waits for the next message, it returns nil if the Client was cancelled.
+func (q *frameQueue) pop(c *Client) []byte {
+	if q.Policy == PolicyBlock {
+		select {
+		case m := <-q.blocking:
+			return m
+		case <-c.Ctx.Done():
+			return nil
+		}
+	}
+
+	for {
+		q.mux.Lock()
+		if len(q.frames) > 0 {
+			m := q.frames[0]
+			q.frames[0] = nil
+			q.frames = q.frames[1:]
+			q.mux.Unlock()
+			return m
+		}
+		if q.spill != nil && q.spill.pending > 0 {
+			m, err := q.spill.read()
+			q.mux.Unlock()
+			if err != nil {
+				c.report(err)
+				continue
+			}
+			return m
+		}
+		if len(q.overflow) > 0 {
+			m := q.overflow[0]
+			q.overflow[0] = nil
+			q.overflow = q.overflow[1:]
+			q.mux.Unlock()
+			return m
+		}
+		q.mux.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-c.Ctx.Done():
+			return nil
+		}
+	}
+}
+
+// drain decodes queued messages one at a time until the Client is cancelled, and removes any spill file.
+func (q *frameQueue) drain(c *Client) {
+	defer func() {
+		q.mux.Lock()
+		defer q.mux.Unlock()
+		if q.spill != nil {
+			q.spill.remove()
+		}
+	}()
+	for {
+		m := q.pop(c)
+		if m == nil {
+			return
+		}
+		if c.ordered != nil {
+			c.ordered.dispatch(c, m)
+			continue
+		}
+		if raw, ok := getRaw(m, c); ok {
+			c.sendResult(raw)
+		}
+	}
+}
+
+// spillFile is an append-only file of length prefixed messages, which is read back from the start and truncated
+// once everything written has been read.
+type spillFile struct {
+	f       *os.File
+	r, w    int64
+	pending int
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "hyperion-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{f: f}, nil
+}
+
+func (s *spillFile) write(m []byte) error {
+	record := make([]byte, 4+len(m))
+	binary.BigEndian.PutUint32(record, uint32(len(m)))
+	copy(record[4:], m)
+	n, err := s.f.WriteAt(record, s.w)
+	s.w += int64(n)
+	if err != nil {
+		return err
+	}
+	s.pending++
+	return nil
+}
+
+func (s *spillFile) read() ([]byte, error) {
+	var size [4]byte
+	if err := s.readAt(size[:], s.r); err != nil {
+		return nil, s.reset(err)
+	}
+	m := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if err := s.readAt(m, s.r+4); err != nil {
+		return nil, s.reset(err)
+	}
+	s.r += int64(4 + len(m))
+	if s.pending--; s.pending == 0 {
+		_ = s.reset(nil)
+	}
+	return m, nil
+}
+
+// readAt fills b from the file at off. Every pending record was written in full, so a short read means the file was
+// truncated and is reported as io.ErrUnexpectedEOF.
+func (s *spillFile) readAt(b []byte, off int64) error {
+	n, err := s.f.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// reset discards everything in the file, which is needed once it has drained or can no longer be read.
+func (s *spillFile) reset(cause error) error {
+	s.r, s.w, s.pending = 0, 0, 0
+	if err := s.f.Truncate(0); err != nil && cause == nil {
+		return err
+	}
+	return cause
+}
+
+func (s *spillFile) remove() {
+	_ = s.f.Close()
+	_ = os.Remove(s.f.Name())
+}
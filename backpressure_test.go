@@ -0,0 +1,239 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// backpressureClient subscribes a client using the policy, and sends count traces without reading them.
+func backpressureClient(t *testing.T, b Backpressure, count int) (*Client, chan HyperionResponse, *fakeConn) {
+	t.Helper()
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithBackpressure(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= count; i++ {
+		fc.send(t, actionFrame(t, uint32(i), uint64(i)))
+	}
+	return c, results, fc
+}
+
+// received reads global sequences until no more arrive.
+func received(t *testing.T, results chan HyperionResponse) []uint64 {
+	t.Helper()
+	seqs := make([]uint64, 0)
+	for {
+		select {
+		case r := <-results:
+			a, err := r.Action()
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, a.GlobalSequence)
+		case <-time.After(300 * time.Millisecond):
+			return seqs
+		}
+	}
+}
+
+// settle waits for the reader to have queued or dropped every message.
+func settle(t *testing.T, c *Client, dropped uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().Dropped < dropped && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	_, results, _ := backpressureClient(t, Backpressure{Policy: PolicyBlock}, 20)
+	seqs := received(t, results)
+	if len(seqs) != 20 {
+		t.Fatalf("expected all 20 traces, got %d", len(seqs))
+	}
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Fatalf("expected traces in order, got %v", seqs)
+		}
+	}
+}
+
+func TestBackpressureDrop(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{PolicyDropNewest, PolicyDropOldest} {
+		c, results, _ := backpressureClient(t, Backpressure{Policy: policy, Size: 2}, 20)
+		// at most 2 queued, one being decoded and one being delivered:
+		settle(t, c, 16)
+		seqs := received(t, results)
+		if dropped := c.Stats().Dropped; int(dropped)+len(seqs) != 20 || dropped < 16 {
+			t.Fatalf("policy %d: %d dropped and %d received", policy, dropped, len(seqs))
+		}
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] <= seqs[i-1] {
+				t.Errorf("policy %d: traces out of order %v", policy, seqs)
+			}
+		}
+		last := seqs[len(seqs)-1]
+		switch {
+		case policy == PolicyDropNewest && last == 20:
+			t.Errorf("newest trace should have been dropped: %v", seqs)
+		case policy == PolicyDropOldest && last != 20:
+			t.Errorf("newest trace should have been kept: %v", seqs)
+		}
+	}
+}
+
+func TestBackpressureControlEvents(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{PolicyDropNewest, PolicyDropOldest} {
+		c, results, fc := backpressureClient(t, Backpressure{Policy: policy, Size: 2}, 10)
+		// the queue is full, but the lib_update must not be dropped:
+		fc.send(t, libFrame(500))
+		for i := 11; i <= 20; i++ {
+			fc.send(t, actionFrame(t, uint32(i), uint64(i)))
+		}
+		settle(t, c, 14)
+		received(t, results)
+		if lib := atomic.LoadUint32(&c.LibNum); lib != 500 {
+			t.Errorf("policy %d: expected lib 500, got %d", policy, lib)
+		}
+		if dropped := c.Stats().Dropped; dropped < 14 {
+			t.Errorf("policy %d: expected traces to be dropped, got %d", policy, dropped)
+		}
+	}
+}
+
+func TestBackpressureDefaultSize(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{PolicyDropNewest, PolicyDropOldest, PolicySpill} {
+		c, results, _ := backpressureClient(t, Backpressure{Policy: policy, Dir: t.TempDir()}, 5)
+		if seqs := received(t, results); len(seqs) != 5 {
+			t.Errorf("policy %d: expected all 5 traces, got %v", policy, seqs)
+		}
+		if stats := c.Stats(); stats.Dropped != 0 || stats.Spilled != 0 {
+			t.Errorf("policy %d: unexpected stats %+v", policy, stats)
+		}
+	}
+}
+
+func TestBackpressureSpill(t *testing.T) {
+	dir := t.TempDir()
+	c, results, _ := backpressureClient(t, Backpressure{Policy: PolicySpill, Size: 1, Dir: dir}, 50)
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().Spilled < 47 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected a spill file, found %d", len(files))
+	}
+
+	seqs := received(t, results)
+	if len(seqs) != 50 {
+		t.Fatalf("expected all 50 traces, got %d", len(seqs))
+	}
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Fatalf("expected traces in order, got %v", seqs)
+		}
+	}
+	if stats := c.Stats(); stats.Dropped != 0 || stats.Spilled < 47 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	_ = c.Close()
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("spill file was not removed")
+	}
+}
+
+func TestSpillWriteFailure(t *testing.T) {
+	c := &Client{}
+	c.Ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	q := &frameQueue{Backpressure: Backpressure{Policy: PolicySpill, Size: 1, Dir: t.TempDir()}, ready: make(chan struct{}, 1)}
+	q.push(c, []byte(`42["message",1]`))
+	q.push(c, []byte(`42["message",2]`))
+	if q.spill == nil || q.spill.pending != 1 {
+		t.Fatal("expected the second trace to be spilled")
+	}
+	defer q.spill.remove()
+	// writes to the spill file now fail, while what was already spilled can still be read:
+	readOnly, err := os.Open(q.spill.f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = q.spill.f.Close()
+	q.spill.f = readOnly
+	q.push(c, []byte(`42["lib_update",3]`))
+	q.push(c, []byte(`42["message",4]`))
+	q.push(c, []byte(`42["fork_event",5]`))
+
+	for _, want := range []string{`42["message",1]`, `42["message",2]`, `42["lib_update",3]`, `42["fork_event",5]`} {
+		if m := q.pop(c); string(m) != want {
+			t.Fatalf("expected %s, got %s", want, m)
+		}
+	}
+	if dropped := q.dropped.Load(); dropped != 1 {
+		t.Errorf("expected the trace after the failure to be dropped, got %d", dropped)
+	}
+	c.wg.Wait()
+}
+
+func TestSpillFile(t *testing.T) {
+	s, err := newSpillFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.remove()
+	for round := 0; round < 2; round++ {
+		for _, m := range []string{"a", "", "bcd"} {
+			if err = s.write([]byte(m)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, want := range []string{"a", "", "bcd"} {
+			m, err := s.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(m) != want {
+				t.Errorf("expected %q, got %q", want, m)
+			}
+		}
+		if s.pending != 0 || s.w != 0 {
+			t.Error("spill file was not reset once drained")
+		}
+	}
+}
+
+func TestSpillFileTruncated(t *testing.T) {
+	s, err := newSpillFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.remove()
+	if err = s.write([]byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.f.Truncate(6); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := s.read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated record, got %q and %v", m, err)
+	}
+	if s.pending != 0 {
+		t.Error("spill file was not reset after the failed read")
+	}
+}
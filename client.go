@@ -2,20 +2,29 @@ package stream
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"math"
+	"net/http"
+	"net/url"
 	"nhooyr.io/websocket"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	pongWait       = 25 * time.Second
 	maxMessageSize = 32768
+	closeTimeout   = 5 * time.Second
 )
 
 // Client is a streaming client using a websocket to connect to Hyperion. The Client.Ctx will get closed when the
-// websocket is terminated.
+// websocket is terminated, or when using WithReconnect, once the client has given up on reconnecting. Client.Close
+// should be used to stop the Client.
 type Client struct {
 	Ctx context.Context
 
@@ -23,120 +32,413 @@ type Client struct {
 	LibId   string
 	ChainId string
 
+	url        string
 	conn       *websocket.Conn
-	reqQueue   chan []byte
+	sid        string
 	cancel     func()
-	subscribed bool
-	wait       chan interface{}
+	mux        sync.Mutex
+	subs       map[uint64]*Subscription
+	lastID     uint64
+	pending    map[uint64]*Subscription
+	lastAck    uint64
+	ackTimeout time.Duration
+	backoff    *Backoff
+	results    chan HyperionResponse
+	errors     chan error
+	incoming   chan HyperionResponse
+	ordered    *orderedPipeline
+	queue      *frameQueue
+	onLive     func(s *Subscription)
+
+	errorHandler  func(err error)
+	errorQueue    chan error
+	errorsDropped atomic.Uint64
+	logger        *slog.Logger
+
+	libMux       sync.Mutex
+	libUpdated   chan struct{}
+	irreversible *irreversibleBuffer
+
+	dialTimeout  time.Duration
+	dialOpts     websocket.DialOptions
+	tlsConfig    *tls.Config
+	proxy        *url.URL
+	readLimit    int64
+	skipOversize bool
+	protocol     Protocol
+	eio          int
+	opening      []byte // the Engine.IO v4 open packet, read by dial before the websocket is served
+	endpoints    []string
+	healthCheck  func(ctx context.Context, endpoint string) error
+	idleTimeout  time.Duration
+
+	stallAfter     time.Duration
+	stallReconnect bool
+	progress       progress
+
+	abis *AbiRegistry
+
+	wg        sync.WaitGroup
+	closing   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures optional behavior of a Client, and is supplied to NewClient.
+type Option func(c *Client)
+
+// WithLiveHandler sets a function that is called when a subscription receives its first live trace, signaling that
+// Hyperion has finished replaying history. It is called again after a reconnect once the subscription has caught up.
+// The function is called before the trace is delivered and must not block.
+func WithLiveHandler(fn func(s *Subscription)) Option {
+	return func(c *Client) {
+		c.onLive = fn
+	}
 }
 
 // NewClient immediately connects to Hyperion, handles ping/pongs, and stores state information such as last
-// irreversible block number in the Client.LibNum. It expects two channels for sending results and errors.
-// Once connected a query will need to be sent before any output is sent over the results channel. If no request is
+// irreversible block number in the Client.LibNum. It expects two channels for sending results and errors, a nil
+// results channel discards any trace that isn't sent to a subscription's own channel or handler. Once connected a query will need to be sent before any output is sent over the results channel. If no request is
 // sent in the first 25 seconds the websocket will be closed by Hyperion.
-func NewClient(url string, results chan HyperionResponse, errors chan error) (*Client, error) {
-	c := &Client{}
-	c.Ctx, c.cancel = context.WithCancel(context.Background())
+func NewClient(url string, results chan HyperionResponse, errors chan error, opts ...Option) (*Client, error) {
+	return NewClientWithContext(context.Background(), url, results, errors, opts...)
+}
 
-	url = strings.TrimRight(url, "/")
-	conn, _, err := websocket.Dial(c.Ctx, url+`/socket.io/?EIO=3&transport=websocket`, &websocket.DialOptions{
-		Subprotocols: []string{"echo"},
-	})
+// NewClientWithContext is the same as NewClient, but the Client.Ctx is derived from ctx: cancelling ctx will tear
+// down the Client, and a deadline on ctx also applies to the initial dial. See WithDialTimeout for limiting each dial
+// without affecting the lifetime of the Client.
+func NewClientWithContext(ctx context.Context, url string, results chan HyperionResponse, errors chan error, opts ...Option) (*Client, error) {
+	c := &Client{
+		url:      strings.TrimRight(url, "/"),
+		results:  results,
+		errors:   errors,
+		incoming: make(chan HyperionResponse),
+		subs:     make(map[uint64]*Subscription),
+		pending:  make(map[uint64]*Subscription),
+		closing:  make(chan struct{}),
+
+		ackTimeout: defaultAckTimeout,
+		libUpdated: make(chan struct{}, 1),
+		readLimit:  maxMessageSize,
+		dialOpts: websocket.DialOptions{
+			Subprotocols: []string{"echo"},
+			HTTPHeader:   make(http.Header),
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.errorQueue == nil {
+		c.errorQueue = make(chan error, defaultErrorBuffer)
+	}
+	c.dialOpts.HTTPClient = c.httpClient()
+	c.Ctx, c.cancel = context.WithCancel(ctx)
+
+	endpoint, conn, err := c.connect("")
 	if err != nil {
+		c.cancel()
 		return nil, err
 	}
+	c.url = endpoint
 	c.conn = conn
-	c.reqQueue = make(chan []byte)
-	c.wait = make(chan interface{})
-	c.conn.SetReadLimit(maxMessageSize)
 
+	if c.ordered != nil {
+		c.ordered.start(c)
+	}
+	if c.queue != nil {
+		c.goroutine(func() {
+			c.queue.drain(c)
+		})
+	}
+	if c.errors != nil && c.errorHandler == nil {
+		c.goroutine(func() {
+			forwardErrors(c.Ctx, c.errorQueue, c.errors, c.closing)
+		})
+	}
+	c.goroutine(c.route)
+	c.goroutine(func() {
+		c.run(conn)
+	})
+
+	return c, nil
+}
+
+// Close sends the socket.io disconnect, closes the websocket with a normal closure status, and waits for all of the
+// Client's goroutines to exit before returning. Client.Ctx is cancelled, and no ExitError is sent.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.mux.Lock()
+		conn := c.conn
+		c.mux.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		// socket.io specific disconnect message:
+		_ = conn.Write(ctx, websocket.MessageText, []byte("41"))
+		c.closeErr = conn.Close(websocket.StatusNormalClosure, "")
+		c.cancel()
+	})
+	c.wg.Wait()
+	return c.closeErr
+}
+
+// goroutine runs fn in the background, tracking it so Close can wait for it to exit.
+func (c *Client) goroutine(fn func()) {
+	c.wg.Add(1)
 	go func() {
-		ping := time.NewTicker((pongWait * 2) / 3)
-		for {
+		defer c.wg.Done()
+		fn()
+	}()
+}
+
+// closed reports whether the Client is shutting down, either via Close or Client.Ctx.
+func (c *Client) closed() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return c.Ctx.Err() != nil
+	}
+}
+
+// report sends an error to the consumer, giving up if the Client is shut down first.
+func (c *Client) report(err error) {
+	c.deliverError(err, c.Ctx.Done())
+}
+
+// run services the websocket until it fails, and then either redials or tears the Client down.
+func (c *Client) run(conn *websocket.Conn) {
+	defer c.shutdown()
+	for {
+		err := c.serve(conn)
+		c.failAcks(err)
+		if c.closed() {
+			return
+		}
+		if c.backoff == nil {
+			c.report(err)
+			return
+		}
+		if conn = c.redial(err); conn == nil {
+			return
+		}
+	}
+}
+
+// shutdown cancels the Client and sends an ExitError, unless Close was called.
+func (c *Client) shutdown() {
+	c.cancel()
+	select {
+	case <-c.closing:
+		return
+	default:
+	}
+
+	c.mux.Lock()
+	conn := c.conn
+	c.mux.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	// socket.io specific disconnect message:
+	_ = conn.Write(ctx, websocket.MessageText, []byte("41"))
+	_ = conn.Close(websocket.StatusNormalClosure, "")
+
+	c.deliverError(ExitError{}, c.closing)
+}
+
+// serve handles the Engine.IO heartbeat and reads messages from a single websocket, returning once the connection fails.
+func (c *Client) serve(conn *websocket.Conn) error {
+	ctx, cancel := context.WithCancel(c.Ctx)
+	defer cancel()
+
+	hb := newHeartbeat(c.eio, c.idleTimeout)
+	c.goroutine(func() {
+		hb.run(ctx, cancel, c, conn)
+	})
+	if c.eio == 4 && c.opening != nil {
+		hb.opened(c, c.opening)
+	}
+
+	for {
+		mtype, message, readErr := c.read(ctx, conn)
+		if readErr != nil {
 			select {
-			case <-c.Ctx.Done():
-				errors <- ExitError{}
-				// socket.io specific disconnect message:
-				_ = c.conn.Write(c.Ctx, websocket.MessageText, []byte("41"))
-				_ = c.conn.CloseRead(context.Background())
-				c.cancel()
-				return
-			case <-ping.C:
-				err = c.conn.Write(c.Ctx, websocket.MessageText, []byte("2"))
-				if err != nil {
-					errors <- err
-				}
+			case err := <-hb.dead:
+				return err
+			default:
+				return readErr
 			}
 		}
-	}()
+		if mtype != websocket.MessageText || len(message) == 0 {
+			continue
+		}
 
-	go func() {
-		<-c.wait
-		for {
-			mtype, message, readErr := c.conn.Read(c.Ctx)
-			if readErr != nil {
-				errors <- readErr
-				c.cancel()
-				break
-			}
-			switch true {
-			case mtype == websocket.MessageText:
-				break
-			case mtype > 1000:
-				c.cancel()
-			default:
-				continue
+		switch message[0] {
+		case '0':
+			// with Engine.IO v4 the open packet was read by dial:
+			hb.opened(c, message)
+			continue
+		case '2':
+			hb.pinged()
+			continue
+		case '3':
+			hb.ponged()
+			continue
+		}
+
+		if len(message) >= 2 && string(message[:2]) == "44" {
+			return parseConnectError(message)
+		}
+		if len(message) > 2 && string(message[:2]) == "43" {
+			c.handleAck(message)
+			continue
+		}
+		if len(message) < 2 || string(message[:2]) != "42" {
+			// only care about event messages from here:
+			continue
+		}
+
+		hb.received()
+		if c.queue != nil {
+			c.queue.push(c, message)
+			continue
+		}
+		if c.ordered != nil {
+			c.ordered.dispatch(c, message)
+			continue
+		}
+		m := message
+		c.goroutine(func() {
+			raw, ok := getRaw(m, c)
+			if !ok {
+				return
 			}
+			c.sendResult(raw)
+		})
+	}
+}
 
-			if len(message) < 2 || string(message[:2]) != "42" {
-				// only care about event messages from here:
+// route receives decoded traces, holding them until irreversible when using WithIrreversibleOnly, and delivers them.
+func (c *Client) route() {
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case <-c.libUpdated:
+			if !c.release() {
+				return
+			}
+		case resp := <-c.incoming:
+			if update, ok := resp.(*libUpdate); ok {
+				c.setLib(update.raw)
 				continue
 			}
-
-			go func(m []byte) {
-				raw, ok := getRaw(m, c, errors)
-				if !ok {
+			c.progress.traced(resp)
+			if fork, ok := resp.(*ForkEvent); ok {
+				if !c.rollback(fork) {
 					return
 				}
-				sendResult(raw, results, errors)
-			}(message)
+				continue
+			}
+			if c.irreversible != nil && !c.hold(resp) {
+				continue
+			}
+			if !c.deliver(resp) {
+				return
+			}
 		}
-	}()
+	}
+}
+
+// deliver sends a result to the subscriptions it matches, or to the Client's results channel if none match. A
+// result is only sent once over each channel, even if several subscriptions sharing the channel match it. It returns
+// false if the Client was cancelled.
+func (c *Client) deliver(resp HyperionResponse) bool {
+	outputs := make([]chan HyperionResponse, 0)
+	live := make([]*Subscription, 0)
+	matched := false
+	c.mux.Lock()
+	for _, s := range c.subscriptions() {
+		if !s.matches(resp) {
+			continue
+		}
+		matched = true
+		if !s.track(resp) || s.closed {
+			continue
+		}
+		if s.caughtUp(resp) {
+			live = append(live, s)
+		}
+		if !s.accepts(resp) {
+			continue
+		}
+		if !hasChan(outputs, s.results) {
+			outputs = append(outputs, s.results)
+		}
+	}
+	c.mux.Unlock()
+	if !matched {
+		outputs = append(outputs, c.results)
+	}
+	if c.onLive != nil {
+		for _, s := range live {
+			c.onLive(s)
+		}
+	}
+
+	for _, out := range outputs {
+		if out == nil {
+			continue
+		}
+		select {
+		case out <- resp:
+		case <-c.Ctx.Done():
+			return false
+		}
+	}
+	return true
+}
 
-	return c, err
+// hasChan reports whether a channel is already in a list of outputs.
+func hasChan(outputs []chan HyperionResponse, ch chan HyperionResponse) bool {
+	for _, out := range outputs {
+		if out == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptions returns the Client's subscriptions ordered by ID. The caller must hold c.mux.
+func (c *Client) subscriptions() []*Subscription {
+	subs := make([]*Subscription, 0, len(c.subs))
+	for _, s := range c.subs {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+	return subs
 }
 
 // getRaw parses out the message, and determines if it needs to be processed. It has been split out
 // to facilitate unit tests.
-func getRaw(m []byte, c *Client, errors chan error) (raw []interface{}, ok bool) {
-	raw = make([]interface{}, 0)
-	e := json.Unmarshal(m[2:], &raw)
+func getRaw(m []byte, c *Client) (raw []interface{}, ok bool) {
+	raw, e := parseRaw(m)
 	if e != nil {
-		errors <- e
+		c.report(e)
 		return nil, false
 	}
-
-	// if it's not a string we're going to end up in trouble since reflection is involved, some socket.io
-	// status messages pass arrays or objects here.
-	switch raw[0].(type) {
-	case string:
-		break
-	default:
+	if raw == nil {
 		return nil, false
 	}
 
 	switch raw[0].(string) {
 	case "lib_update":
-		// track lib updates in stream.Client variables:
-		update := raw[1].(map[string]interface{})
-		if update["chain_id"] == nil || update["block_num"] == nil || update["block_id"] == nil {
-			return nil, false
-		}
-		c.ChainId = update["chain_id"].(string)
-		c.LibNum = uint32(math.Round(update["block_num"].(float64)))
-		c.LibId = update["block_id"].(string)
+		c.setLib(raw)
 		return nil, false
-	case "message":
+	case "message", "fork_event":
 		break
 	default:
 		// everything else we don't care
@@ -145,80 +447,252 @@ func getRaw(m []byte, c *Client, errors chan error) (raw []interface{}, ok bool)
 	return raw, true
 }
 
-// sendResult performs final processing of the message, and forwards along if it is valid.
-func sendResult(raw []interface{}, results chan HyperionResponse, errors chan error) {
+// parseRaw decodes a socket.io event, returning a nil slice if it isn't an event this library can handle.
+func parseRaw(m []byte) (raw []interface{}, err error) {
+	raw = make([]interface{}, 0)
+	err = json.Unmarshal(m[2:], &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// if it's not a string we're going to end up in trouble since reflection is involved, some socket.io
+	// status messages pass arrays or objects here.
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	switch raw[0].(type) {
+	case string:
+		return raw, nil
+	default:
+		return nil, nil
+	}
+}
+
+// setLib tracks lib updates in stream.Client variables.
+func (c *Client) setLib(raw []interface{}) {
 	if len(raw) != 2 {
 		return
 	}
-	var e error
+	update, ok := raw[1].(map[string]interface{})
+	if !ok || update["chain_id"] == nil || update["block_num"] == nil || update["block_id"] == nil {
+		return
+	}
+	// without WithOrderedDelivery updates are handled concurrently:
+	c.libMux.Lock()
+	defer c.libMux.Unlock()
+	c.ChainId, _ = update["chain_id"].(string)
+	blockNum, _ := update["block_num"].(float64)
+	lib := uint32(math.Round(blockNum))
+	if lib > atomic.LoadUint32(&c.LibNum) {
+		c.progress.advanceLib()
+	}
+	atomic.StoreUint32(&c.LibNum, lib)
+	c.LibId, _ = update["block_id"].(string)
 
-	// make sure we have have a map
-	switch raw[1].(type) {
-	case map[string]interface{}:
-		break
+	select {
+	case c.libUpdated <- struct{}{}:
 	default:
-		return
 	}
+}
 
-	if raw[1].(map[string]interface{})["type"] == nil || raw[1].(map[string]interface{})["message"] == nil {
+// sendResult performs final processing of the message, and forwards along if it is valid.
+func (c *Client) sendResult(raw []interface{}) {
+	responses, e := decodeResult(raw)
+	if e != nil {
+		c.report(e)
 		return
 	}
-
-	switch raw[1].(map[string]interface{})["type"].(string) {
-	case "delta_trace":
-		d := &DeltaTrace{}
-		e = json.Unmarshal([]byte(raw[1].(map[string]interface{})["message"].(string)), d)
-		if e != nil {
-			errors <- e
+	if c.abis != nil {
+		c.normalize(responses)
+	}
+	for _, resp := range responses {
+		select {
+		case c.incoming <- resp:
+		case <-c.Ctx.Done():
 			return
 		}
-		results <- d
-	case "action_trace":
-		a := &ActionTrace{}
-		e = json.Unmarshal([]byte(raw[1].(map[string]interface{})["message"].(string)), a)
-		if e != nil {
-			errors <- e
-			return
+	}
+}
+
+// decodeResult converts a message event into ActionTraces or DeltaTraces, carrying the Envelope fields on each.
+// Live traces arrive one per message as a JSON encoded string, while history is sent in batches using an array.
+// A fork_event is converted to a ForkEvent.
+func decodeResult(raw []interface{}) ([]HyperionResponse, error) {
+	if len(raw) != 2 {
+		return nil, nil
+	}
+	if raw[0] == "fork_event" {
+		return decodeFork(raw[1])
+	}
+
+	// make sure we have have a map
+	msg, ok := raw[1].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	env := Envelope{Extra: make(map[string]interface{})}
+	env.Type, _ = msg["type"].(string)
+	mode, _ := msg["mode"].(string)
+	env.Mode = ResponseMode(mode)
+	for k, v := range msg {
+		switch k {
+		case "type", "mode", "message", "messages":
+		default:
+			env.Extra[k] = v
 		}
-		results <- a
 	}
+
+	bodies := make([][]byte, 0)
+	if m, ok := msg["message"].(string); ok {
+		bodies = append(bodies, []byte(m))
+	}
+	if batch, ok := msg["messages"].([]interface{}); ok {
+		for _, m := range batch {
+			if s, ok := m.(string); ok {
+				bodies = append(bodies, []byte(s))
+				continue
+			}
+			b, e := json.Marshal(m)
+			if e != nil {
+				return nil, e
+			}
+			bodies = append(bodies, b)
+		}
+	}
+
+	responses := make([]HyperionResponse, 0, len(bodies))
+	for _, b := range bodies {
+		switch env.Type {
+		case "delta_trace":
+			d := &DeltaTrace{mode: env.Mode, envelope: env}
+			e := json.Unmarshal(b, d)
+			if e != nil {
+				return nil, e
+			}
+			responses = append(responses, d)
+		case "action_trace":
+			a := &ActionTrace{mode: env.Mode, envelope: env}
+			e := json.Unmarshal(b, a)
+			if e != nil {
+				return nil, e
+			}
+			responses = append(responses, a)
+		default:
+			return nil, nil
+		}
+	}
+	return responses, nil
 }
 
-// StreamActions will emit an action stream request to Hyperion. Note that only one stream subscription is supported
-// in this library to keep things simple.
+// StreamActions will emit an action stream request to Hyperion, traces will be sent over the Client's results
+// channel. It blocks until Hyperion acknowledges the request, or the ack timeout (see WithAckTimeout) has passed. See
+// SubscribeActions for using a separate channel per request.
 func (c *Client) StreamActions(req *ActionsReq) error {
-	if c.subscribed {
-		return BusyError{}
+	ctx, cancel := context.WithTimeout(c.Ctx, c.ackTimeout)
+	defer cancel()
+	_, err := c.SubscribeActions(ctx, req, nil)
+	return err
+}
+
+// StreamDeltas will emit an delta stream request to Hyperion, traces will be sent over the Client's results channel.
+// It blocks until Hyperion acknowledges the request, or the ack timeout (see WithAckTimeout) has passed. See
+// SubscribeDeltas for using a separate channel per request.
+func (c *Client) StreamDeltas(req *DeltasReq) error {
+	ctx, cancel := context.WithTimeout(c.Ctx, c.ackTimeout)
+	defer cancel()
+	_, err := c.SubscribeDeltas(ctx, req, nil)
+	return err
+}
+
+// SubscribeActions will emit an action stream request to Hyperion, any number of action and delta subscriptions can
+// share a Client. Matching traces are sent over results, or the Client's results channel if it is nil. It blocks
+// until Hyperion acknowledges the request or ctx is done, and returns a StreamRequestError if Hyperion rejected it.
+// A BusyError is returned if an identical request is already active, and a FilterError if a filter is malformed.
+func (c *Client) SubscribeActions(ctx context.Context, req *ActionsReq, results chan HyperionResponse) (*Subscription, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return c.subscribe(ctx, &Subscription{Actions: req, results: results})
+}
+
+// SubscribeDeltas will emit a delta stream request to Hyperion, any number of action and delta subscriptions can
+// share a Client. Matching traces are sent over results, or the Client's results channel if it is nil. It blocks
+// until Hyperion acknowledges the request or ctx is done, and returns a StreamRequestError if Hyperion rejected it.
+// A BusyError is returned if an identical request is already active.
+func (c *Client) SubscribeDeltas(ctx context.Context, req *DeltasReq, results chan HyperionResponse) (*Subscription, error) {
+	return c.subscribe(ctx, &Subscription{Deltas: req, results: results})
+}
+
+// Unsubscribe stops delivering traces for a Subscription. Hyperion has no way to cancel a single request, so its
+// traces will still be received, and discarded, until the websocket is reconnected.
+func (c *Client) Unsubscribe(s *Subscription) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	s.closed = true
+}
+
+func (c *Client) subscribe(ctx context.Context, s *Subscription) (*Subscription, error) {
+	if s.results == nil {
+		s.results = c.results
+	}
+	s.acked = make(chan error, 1)
+	s.waiting = true
+	s.predicate = s.requestPredicate()
+	var err error
+	if _, s.original, err = s.request(); err != nil {
+		return nil, err
+	}
+
+	c.mux.Lock()
+	for _, active := range c.subs {
+		if !active.closed && active.sameRequest(s) {
+			c.mux.Unlock()
+			return nil, BusyError{}
+		}
 	}
-	j, err := req.ToJson()
+	c.lastID++
+	s.ID = c.lastID
+	err = c.request(s)
 	if err != nil {
-		return err
+		c.mux.Unlock()
+		return nil, err
+	}
+	c.subs[s.ID] = s
+	c.mux.Unlock()
+
+	select {
+	case err = <-s.acked:
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
-	err = c.conn.Write(c.Ctx, websocket.MessageText, append(append([]byte(`420["action_stream_request",`), j...), []byte("]")...))
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	s.waiting = false
 	if err != nil {
-		return err
+		delete(c.subs, s.ID)
+		delete(c.pending, s.ackID)
+		return nil, err
 	}
-	c.subscribed = true
-	close(c.wait)
-	return nil
+	return s, nil
 }
 
-// StreamDeltas will emit an delta stream request to Hyperion.
-func (c *Client) StreamDeltas(req *DeltasReq) error {
-	if c.subscribed {
-		return BusyError{}
-	}
-	j, err := req.ToJson()
+// request writes the stream request for a subscription to the current websocket, using a new socket.io ack id so
+// Hyperion's reply can be matched to it. The caller must hold c.mux.
+func (c *Client) request(s *Subscription) error {
+	event, j, err := s.request()
 	if err != nil {
 		return err
 	}
-	err = c.conn.Write(c.Ctx, websocket.MessageText, append(append([]byte(`420["delta_stream_request",`), j...), []byte("]")...))
+	c.lastAck++
+	s.ackID = c.lastAck
+	c.pending[s.ackID] = s
+	err = c.conn.Write(c.Ctx, websocket.MessageText, append(append([]byte(fmt.Sprintf(`42%d["%s",`, s.ackID, event)), j...), []byte("]")...))
 	if err != nil {
-		return err
+		delete(c.pending, s.ackID)
 	}
-	c.subscribed = true
-	close(c.wait)
-	return nil
+	return err
 }
 
 // ExitError is used when the socket.io-specific exit message is received
@@ -229,10 +703,10 @@ func (e ExitError) Error() string {
 	return "websocket closed"
 }
 
-// BusyError is used when a socket already has a subscription
+// BusyError is used when a socket already has an identical subscription
 type BusyError struct{}
 
 // Error satisfies the error interface
 func (b BusyError) Error() string {
-	return "websocket subscription already active, please use a new client for additional subscriptions"
+	return "an identical subscription is already active on this websocket"
 }
@@ -3,9 +3,9 @@ package stream
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"nhooyr.io/websocket"
-	"nhooyr.io/websocket/wsjson"
 	"testing"
 	"time"
 )
@@ -21,23 +21,33 @@ func wsDriver() {
 		ctx, cancel := context.WithTimeout(r.Context(), time.Second*3)
 		defer cancel()
 
-		var v interface{}
 		for {
-			err = wsjson.Read(ctx, c, &v)
+			_, m, err := c.Read(ctx)
 			if err != nil {
 				break
 			}
+			// acknowledge stream requests:
+			if req := requestPattern.FindStringSubmatch(string(m)); req != nil {
+				_ = c.Write(ctx, websocket.MessageText, []byte("43"+req[1]+`[{"status":"OK"}]`))
+			}
 		}
 		_ = c.Close(websocket.StatusNormalClosure, "")
 	})
 	http.HandleFunc("/socket.io/", handler)
-	_ = http.ListenAndServe("localhost:23456", nil)
+	// listen before returning so the client does not race the server:
+	l, err := net.Listen("tcp", "localhost:23456")
+	if err != nil {
+		return
+	}
+	go func() {
+		_ = http.Serve(l, nil)
+	}()
 }
 
 func TestStreamActions(t *testing.T) {
 	results := make(chan HyperionResponse)
 	errors := make(chan error)
-	go wsDriver()
+	wsDriver()
 	c, err := NewClient("ws://localhost:23456", results, errors)
 	if err != nil {
 		t.Error("new client:", err)
@@ -51,7 +61,9 @@ func TestStreamActions(t *testing.T) {
 	for {
 		select {
 		case <-time.After(time.Second):
-			c.cancel()
+			if err = c.Close(); err != nil {
+				t.Error("close:", err)
+			}
 		case <-c.Ctx.Done():
 			return
 		case m := <-results:
@@ -78,7 +90,9 @@ func TestStreamDeltas(t *testing.T) {
 	for {
 		select {
 		case <-time.After(time.Second):
-			c.cancel()
+			if err = c.Close(); err != nil {
+				t.Error("close:", err)
+			}
 		case <-c.Ctx.Done():
 			return
 		case m := <-results:
@@ -98,3 +112,65 @@ func TestClientErrors(t *testing.T) {
 		t.Error("ExitError empty")
 	}
 }
+
+func TestClientClose(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error)
+	c, err := NewClient(f.url(), results, errors, WithOrderedDelivery(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := f.accept(t)
+
+	// nothing reads the errors or results channels, Close must not deadlock:
+	fc.send(t, actionFrame(t, 1, 1))
+	done := make(chan error)
+	go func() {
+		done <- c.Close()
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error("close:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not return")
+	}
+	fc.expect(t, "41")
+	if c.Ctx.Err() == nil {
+		t.Error("context was not cancelled")
+	}
+	if err = c.Close(); err != nil {
+		t.Error("second close:", err)
+	}
+}
+
+func TestNewClientWithContext(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := NewClientWithContext(ctx, f.url(), results, errors, WithDialTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.accept(t)
+	cancel()
+	select {
+	case e := <-errors:
+		if _, ok := e.(ExitError); !ok {
+			t.Errorf("expected ExitError, got %v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("parent cancellation did not stop the client")
+	}
+	<-c.Ctx.Done()
+	_ = c.Close()
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if _, err = NewClientWithContext(expired, f.url(), results, errors); err == nil {
+		t.Error("expected dial to fail with an expired context")
+	}
+}
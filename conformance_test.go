@@ -0,0 +1,245 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestFixtureConformance round trips traces captured from Hyperion through ActionTrace and DeltaTrace, failing if
+// any field is dropped or changed. Fixtures are in testdata/hyperion, named action_*.json or delta_*.json, and must be
+// the message of a trace exactly as Hyperion sent it. Cases the captures don't cover yet, such as removed rows,
+// context free actions and unknown fields, are derived from each of them by actionVariants and deltaVariants.
+func TestFixtureConformance(t *testing.T) {
+	paths, err := filepath.Glob("testdata/hyperion/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			fixture, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var variants []fixtureVariant
+			var decode func() interface{}
+			switch {
+			case strings.HasPrefix(filepath.Base(path), "action_"):
+				variants, decode = actionVariants, func() interface{} { return &ActionTrace{} }
+			case strings.HasPrefix(filepath.Base(path), "delta_"):
+				variants, decode = deltaVariants, func() interface{} { return &DeltaTrace{} }
+			default:
+				t.Fatal("fixtures should be named action_*.json or delta_*.json")
+			}
+
+			roundTrip(t, fixture, decode())
+			for _, v := range variants {
+				v := v
+				t.Run(v.name, func(t *testing.T) {
+					trace := decode()
+					roundTrip(t, v.derive(t, fixture), trace)
+					v.check(t, trace)
+				})
+			}
+		})
+	}
+}
+
+// roundTrip decodes the fixture into trace and encodes it again, reporting every difference.
+func roundTrip(t *testing.T, fixture []byte, trace interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(fixture, trace); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, diff := range diffJSON(t, fixture, out) {
+		t.Error(diff)
+	}
+}
+
+// fixtureVariant changes a captured trace into a case no capture covers yet, and checks the decoded trace.
+type fixtureVariant struct {
+	name   string
+	change func(trace map[string]interface{})
+	check  func(t *testing.T, trace interface{})
+}
+
+// derive applies the variant's change to a fixture.
+func (v fixtureVariant) derive(t *testing.T, fixture []byte) []byte {
+	t.Helper()
+	var trace map[string]interface{}
+	if err := json.Unmarshal(fixture, &trace); err != nil {
+		t.Fatal(err)
+	}
+	v.change(trace)
+	b, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+var actionVariants = []fixtureVariant{
+	{
+		name: "context_free",
+		change: func(action map[string]interface{}) {
+			action["context_free"] = true
+			action["act"].(map[string]interface{})["authorization"] = []interface{}{}
+		},
+		check: func(t *testing.T, trace interface{}) {
+			if a := trace.(*ActionTrace); !a.ContextFree || len(a.Act.Authorization) != 0 {
+				t.Errorf("expected a context free action without authorization, got %v and %v", a.ContextFree, a.Act.Authorization)
+			}
+		},
+	},
+	{
+		name: "extra",
+		change: func(action map[string]interface{}) {
+			action["console"] = "hello"
+			action["account_ram_deltas"] = []interface{}{map[string]interface{}{"account": "alice", "delta": float64(112)}}
+		},
+		check: func(t *testing.T, trace interface{}) {
+			if a := trace.(*ActionTrace); a.Extra["console"] == nil || a.Extra["account_ram_deltas"] == nil {
+				t.Errorf("expected the unknown fields in Extra, got %v", a.Extra)
+			}
+		},
+	},
+	{
+		name: "nested_extra",
+		change: func(action map[string]interface{}) {
+			action["act"].(map[string]interface{})["hex_data"] = "0a0b0c"
+			for _, r := range action["receipts"].([]interface{}) {
+				r.(map[string]interface{})["code_sequence"] = float64(36)
+				r.(map[string]interface{})["abi_sequence"] = float64(10)
+			}
+		},
+		check: func(t *testing.T, trace interface{}) {
+			a := trace.(*ActionTrace)
+			if a.Act.Extra["hex_data"] == nil {
+				t.Errorf("expected act.hex_data in Act.Extra, got %v", a.Act.Extra)
+			}
+			for i, r := range a.Receipts {
+				if r.Extra["code_sequence"] == nil || r.Extra["abi_sequence"] == nil {
+					t.Errorf("expected the unknown fields of receipt %d in its Extra, got %v", i, r.Extra)
+				}
+			}
+		},
+	},
+}
+
+var deltaVariants = []fixtureVariant{
+	{
+		name: "removed",
+		change: func(delta map[string]interface{}) {
+			delta["present"] = false
+		},
+		check: func(t *testing.T, trace interface{}) {
+			if trace.(*DeltaTrace).Present {
+				t.Error("expected a removed row")
+			}
+		},
+	},
+	{
+		name: "extra",
+		change: func(delta map[string]interface{}) {
+			delta["data_hex"] = "0a0b"
+			delta["ram"] = map[string]interface{}{"payer": "alice", "delta": float64(-112)}
+		},
+		check: func(t *testing.T, trace interface{}) {
+			if d := trace.(*DeltaTrace); d.Extra["data_hex"] == nil || d.Extra["ram"] == nil {
+				t.Errorf("expected the unknown fields in Extra, got %v", d.Extra)
+			}
+		},
+	},
+}
+
+func TestAuthSequence(t *testing.T) {
+	for _, in := range []string{
+		`{"account":"m.federation","sequence":"50649143"}`,
+		`{"account":"m.federation","sequence":50649143}`,
+		`["m.federation",50649143]`,
+		`["m.federation","50649143"]`,
+	} {
+		var as AuthSequence
+		if err := json.Unmarshal([]byte(in), &as); err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if as.Account != "m.federation" || as.Sequence != 50649143 {
+			t.Errorf("%s: unexpected auth sequence %+v", in, as)
+		}
+	}
+	for _, in := range []string{`{"account":"a","sequence":"x"}`, `["a"]`, `"a"`} {
+		var as AuthSequence
+		if err := json.Unmarshal([]byte(in), &as); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+}
+
+// diffJSON lists the differences between the JSON Hyperion sent and the JSON produced from the decoded trace.
+func diffJSON(t *testing.T, want []byte, got []byte) []string {
+	t.Helper()
+	decode := func(b []byte) interface{} {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	return diffValues("", decode(want), decode(got))
+}
+
+func diffValues(path string, want interface{}, got interface{}) []string {
+	wantMap, wantIsMap := want.(map[string]interface{})
+	gotMap, gotIsMap := got.(map[string]interface{})
+	if wantIsMap && gotIsMap {
+		diffs := make([]string, 0)
+		keys := make([]string, 0, len(wantMap))
+		for k := range wantMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, ok := gotMap[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s%s was dropped", path, k))
+				continue
+			}
+			diffs = append(diffs, diffValues(path+k+".", wantMap[k], gotMap[k])...)
+		}
+		for k := range gotMap {
+			if _, ok := wantMap[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s%s was added", path, k))
+			}
+		}
+		return diffs
+	}
+	wantList, wantIsList := want.([]interface{})
+	gotList, gotIsList := got.([]interface{})
+	if wantIsList && gotIsList && len(wantList) == len(gotList) {
+		diffs := make([]string, 0)
+		for i := range wantList {
+			diffs = append(diffs, diffValues(fmt.Sprintf("%s%d.", path, i), wantList[i], gotList[i])...)
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(want, got) {
+		return []string{fmt.Sprintf("%s changed from %v to %v", strings.TrimSuffix(path, "."), want, got)}
+	}
+	return nil
+}
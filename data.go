@@ -0,0 +1,195 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// actionFields, actFields, receiptFields and deltaFields are the keys of the traces' JSON that are decoded into struct
+// fields, any others are kept in Extra.
+var (
+	actionFields  = jsonFields(reflect.TypeOf(ActionTrace{}))
+	actFields     = jsonFields(reflect.TypeOf(ActionTrace{}.Act))
+	receiptFields = jsonFields(reflect.TypeOf(Receipt{}))
+	deltaFields   = jsonFields(reflect.TypeOf(DeltaTrace{}))
+)
+
+// jsonFields returns the names of a struct's fields in JSON.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// UnmarshalJSON decodes an ActionTrace, keeping the JSON it was decoded from in Raw, any unknown fields in Extra and
+// Act.Extra, and the raw JSON of Act.Data for DecodeData.
+func (act *ActionTrace) UnmarshalJSON(b []byte) error {
+	type plain ActionTrace
+	if err := json.Unmarshal(b, (*plain)(act)); err != nil {
+		return err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	actRaw := make(map[string]json.RawMessage)
+	if fields["act"] != nil {
+		if err := json.Unmarshal(fields["act"], &actRaw); err != nil {
+			return err
+		}
+	}
+	act.Act.RawData = actRaw["data"]
+	act.Act.Extra = extraFields(actRaw, actFields)
+	act.Raw = append(json.RawMessage(nil), b...)
+	act.Extra = extraFields(fields, actionFields)
+	return nil
+}
+
+// MarshalJSON encodes an ActionTrace including any fields in Extra and Act.Extra.
+func (act ActionTrace) MarshalJSON() ([]byte, error) {
+	type plain ActionTrace
+	b, err := marshalWithExtra((*plain)(&act), act.Extra)
+	if err != nil || len(act.Act.Extra) == 0 {
+		return b, err
+	}
+	inner, err := marshalWithExtra(act.Act, act.Act.Extra)
+	if err != nil {
+		return nil, err
+	}
+	return setField(b, "act", inner)
+}
+
+// UnmarshalJSON decodes a Receipt, keeping any unknown fields in Extra.
+func (r *Receipt) UnmarshalJSON(b []byte) error {
+	type plain Receipt
+	if err := json.Unmarshal(b, (*plain)(r)); err != nil {
+		return err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	r.Extra = extraFields(fields, receiptFields)
+	return nil
+}
+
+// MarshalJSON encodes a Receipt including any fields in Extra.
+func (r Receipt) MarshalJSON() ([]byte, error) {
+	type plain Receipt
+	return marshalWithExtra((*plain)(&r), r.Extra)
+}
+
+// DecodeData decodes Act.Data into v, which is usually a pointer to a struct with json tags matching the action's
+// ABI. eos-go types such as eos.Asset, eos.AccountName and eos.Uint64 may be used as field types.
+func (act *ActionTrace) DecodeData(v interface{}) error {
+	return decodeData(act.Act.RawData, act.Act.Data, v)
+}
+
+// UnmarshalJSON decodes a DeltaTrace, keeping the JSON it was decoded from in Raw, any unknown fields in Extra, and
+// the raw JSON of Data for DecodeData.
+func (d *DeltaTrace) UnmarshalJSON(b []byte) error {
+	type plain DeltaTrace
+	if err := json.Unmarshal(b, (*plain)(d)); err != nil {
+		return err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	d.RawData = fields["data"]
+	d.Raw = append(json.RawMessage(nil), b...)
+	d.Extra = extraFields(fields, deltaFields)
+	return nil
+}
+
+// MarshalJSON encodes a DeltaTrace including any fields in Extra.
+func (d DeltaTrace) MarshalJSON() ([]byte, error) {
+	type plain DeltaTrace
+	return marshalWithExtra((*plain)(&d), d.Extra)
+}
+
+// extraFields returns the fields that are not known, or nil if there are none.
+func extraFields(fields map[string]json.RawMessage, known map[string]bool) map[string]json.RawMessage {
+	var extra map[string]json.RawMessage
+	for k, v := range fields {
+		if known[k] {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]json.RawMessage)
+		}
+		extra[k] = v
+	}
+	return extra
+}
+
+// marshalWithExtra encodes v, adding the extra fields that it does not already have.
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return b, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for k, raw := range extra {
+		if _, ok := fields[k]; !ok {
+			fields[k] = raw
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// setField replaces a field of a JSON object.
+func setField(b []byte, key string, value json.RawMessage) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	fields[key] = value
+	return json.Marshal(fields)
+}
+
+// DecodeData decodes the table row in Data into v, see ActionTrace.DecodeData. Hyperion sends the row as a hex string
+// if it could not be deserialized with the contract's ABI, which will fail to decode into a struct.
+func (d *DeltaTrace) DecodeData(v interface{}) error {
+	return decodeData(d.RawData, d.Data, v)
+}
+
+// decodeData unmarshals the raw JSON into v, falling back to re-encoding the decoded data if the trace was not
+// built from JSON.
+func decodeData(raw json.RawMessage, data interface{}, v interface{}) error {
+	if len(raw) == 0 {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return DataError{Err: err}
+		}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return DataError{Err: err}
+	}
+	return nil
+}
+
+// DataError is returned by DecodeData when the trace's data does not fit the value it is decoded into.
+type DataError struct {
+	Err error
+}
+
+// Error satisfies the error interface
+func (de DataError) Error() string {
+	return fmt.Sprintf("could not decode trace data: %v", de.Err)
+}
+
+// Unwrap returns the JSON error
+func (de DataError) Unwrap() error {
+	return de.Err
+}
@@ -0,0 +1,201 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/eoscanada/eos-go"
+	"strings"
+	"testing"
+)
+
+type transfer struct {
+	From     eos.AccountName `json:"from"`
+	To       eos.AccountName `json:"to"`
+	Quantity eos.Asset       `json:"quantity"`
+	Memo     string          `json:"memo"`
+}
+
+func TestActionDecodeData(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := &ActionTrace{BlockNum: 1, GlobalSequence: 1}
+	trace.Act.Account = "eosio.token"
+	trace.Act.Name = "transfer"
+	trace.Act.Data = map[string]interface{}{"from": "alice", "to": "bob", "quantity": "1.2500 EOS", "memo": "hi"}
+	fc.send(t, traceFrame(t, "action_trace", RespModeLive, trace))
+
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Act.RawData) == 0 {
+		t.Error("expected the raw data to be kept")
+	}
+	var tr transfer
+	if err = a.DecodeData(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.From != "alice" || tr.To != "bob" || tr.Memo != "hi" {
+		t.Errorf("unexpected transfer: %+v", tr)
+	}
+	if tr.Quantity.Amount != 12500 || tr.Quantity.Symbol.Symbol != "EOS" || tr.Quantity.Precision != 4 {
+		t.Errorf("unexpected quantity: %v", tr.Quantity)
+	}
+}
+
+func TestDeltaDecodeData(t *testing.T) {
+	d := &DeltaTrace{}
+	if err := d.UnmarshalJSON([]byte(`{"code":"eosio.token","table":"accounts","data":{"balance":"10.0000 WAX"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	var row struct {
+		Balance eos.Asset `json:"balance"`
+	}
+	if err := d.DecodeData(&row); err != nil {
+		t.Fatal(err)
+	}
+	if row.Balance.Amount != 100000 || row.Balance.Symbol.Symbol != "WAX" {
+		t.Errorf("unexpected balance: %v", row.Balance)
+	}
+	if d.Code != "eosio.token" || d.Table != "accounts" {
+		t.Errorf("the other fields should still be decoded: %+v", d)
+	}
+
+	// a row that could not be deserialized by Hyperion is sent as hex:
+	d = &DeltaTrace{}
+	if err := d.UnmarshalJSON([]byte(`{"data":"0a0b0c"}`)); err != nil {
+		t.Fatal(err)
+	}
+	err := d.DecodeData(&row)
+	if !errors.As(err, new(DataError)) {
+		t.Errorf("expected a DataError, got %v", err)
+	}
+}
+
+func TestDecodeDataWithoutJSON(t *testing.T) {
+	a := &ActionTrace{}
+	a.Act.Data = map[string]interface{}{"from": "alice", "quantity": "0.0001 TLM"}
+	var tr transfer
+	if err := a.DecodeData(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.From != "alice" || tr.Quantity.Amount != 1 {
+		t.Errorf("unexpected transfer: %+v", tr)
+	}
+}
+
+func TestRawAndExtra(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio", "", "buyrambytes")); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"act":{"account":"eosio","name":"buyrambytes","data":{"bytes":8192}},"block_num":1,"global_sequence":1,` +
+		`"console":"hello","account_ram_deltas":[{"account":"alice","delta":8192}]}`
+	frame, err := json.Marshal([]interface{}{"message", map[string]interface{}{"type": "action_trace", "mode": "live", "message": body}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc.send(t, "42"+string(frame))
+
+	resp := nextResult(t, results)
+	if string(resp.RawJSON()) != body {
+		t.Errorf("expected the raw JSON to be kept exactly, got %s", resp.RawJSON())
+	}
+	a, err := resp.Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Extra) != 2 || string(a.Extra["console"]) != `"hello"` || string(a.Extra["account_ram_deltas"]) != `[{"account":"alice","delta":8192}]` {
+		t.Errorf("unexpected extra fields: %v", a.Extra)
+	}
+
+	// extra fields are forwarded when the trace is encoded again:
+	var encoded map[string]json.RawMessage
+	if err = json.Unmarshal(a.ToJson(), &encoded); err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded["console"]) != `"hello"` || encoded["account_ram_deltas"] == nil || encoded["block_num"] == nil {
+		t.Errorf("expected the extra fields to be encoded, got %v", encoded)
+	}
+}
+
+func TestNestedExtra(t *testing.T) {
+	body := `{"act":{"account":"eosio.token","name":"transfer","authorization":[],"data":{"memo":""},"hex_data":"00"},` +
+		`"receipts":[{"receiver":"alice","global_sequence":"5","recv_sequence":"3","auth_sequence":[],"code_sequence":2}]}`
+	a := &ActionTrace{}
+	if err := json.Unmarshal([]byte(body), a); err != nil {
+		t.Fatal(err)
+	}
+	if string(a.Act.Extra["hex_data"]) != `"00"` || len(a.Act.Extra) != 1 {
+		t.Errorf("unexpected act extra fields: %v", a.Act.Extra)
+	}
+	if len(a.Receipts) != 1 || string(a.Receipts[0].Extra["code_sequence"]) != "2" || len(a.Receipts[0].Extra) != 1 {
+		t.Fatalf("unexpected receipts: %+v", a.Receipts)
+	}
+	if a.Extra != nil {
+		t.Errorf("nested fields should not be top level extras: %v", a.Extra)
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded struct {
+		Act      map[string]json.RawMessage   `json:"act"`
+		Receipts []map[string]json.RawMessage `json:"receipts"`
+	}
+	if err = json.Unmarshal(b, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded.Act["hex_data"]) != `"00"` || string(encoded.Act["name"]) != `"transfer"` {
+		t.Errorf("expected act.hex_data to be encoded, got %s", b)
+	}
+	if len(encoded.Receipts) != 1 || string(encoded.Receipts[0]["code_sequence"]) != "2" || string(encoded.Receipts[0]["receiver"]) != `"alice"` {
+		t.Errorf("expected receipts[0].code_sequence to be encoded, got %s", b)
+	}
+}
+
+func TestDeltaExtra(t *testing.T) {
+	d := &DeltaTrace{}
+	if err := json.Unmarshal([]byte(`{"code":"eosio","table":"global","data_hex":"0a0b"}`), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Extra) != 1 || string(d.Extra["data_hex"]) != `"0a0b"` {
+		t.Errorf("unexpected extra fields: %v", d.Extra)
+	}
+	if d.RawJSON() == nil {
+		t.Error("expected the raw JSON to be kept")
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"data_hex":"0a0b"`) {
+		t.Errorf("expected the extra field to be encoded, got %s", b)
+	}
+
+	// traces that were not decoded from JSON have neither:
+	if (&DeltaTrace{}).RawJSON() != nil || (&ActionTrace{}).Extra != nil {
+		t.Error("expected no raw JSON or extra fields")
+	}
+}
@@ -0,0 +1,169 @@
+package stream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"nhooyr.io/websocket"
+	"time"
+)
+
+// WithDialTimeout limits how long each attempt to dial Hyperion may take, including redials when using
+// WithReconnect.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = d
+	}
+}
+
+// WithHTTPClient sets the http.Client used for the websocket handshake, a Timeout on the client only limits the
+// handshake. WithTLSConfig and WithProxy are applied to a copy of its transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.dialOpts.HTTPClient = client
+	}
+}
+
+// WithHeader adds a header to the websocket handshake, such as an API key required by a provider. It may be used more
+// than once, including for the same key.
+func WithHeader(key string, value string) Option {
+	return func(c *Client) {
+		c.dialOpts.HTTPHeader.Add(key, value)
+	}
+}
+
+// WithTLSConfig sets the TLS configuration for wss:// endpoints, for example to trust a private CA bundle.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithProxy connects to Hyperion through an HTTP proxy. Without this option the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+// environment variables are honored by the default transport.
+func WithProxy(proxy *url.URL) Option {
+	return func(c *Client) {
+		c.proxy = proxy
+	}
+}
+
+// WithSubprotocols replaces the websocket subprotocols offered to Hyperion, which defaults to "echo".
+func WithSubprotocols(protocols ...string) Option {
+	return func(c *Client) {
+		c.dialOpts.Subprotocols = protocols
+	}
+}
+
+// WithCompression sets the permessage-deflate mode negotiated with Hyperion, and the minimum size of a message before
+// it is compressed. Compression is disabled by default, a threshold of zero uses the websocket library's default.
+func WithCompression(mode websocket.CompressionMode, threshold int) Option {
+	return func(c *Client) {
+		c.dialOpts.CompressionMode = mode
+		c.dialOpts.CompressionThreshold = threshold
+	}
+}
+
+// httpClient returns the http.Client for the handshake, applying the TLS and proxy options to a copy of its transport.
+func (c *Client) httpClient() *http.Client {
+	client := c.dialOpts.HTTPClient
+	if c.tlsConfig == nil && c.proxy == nil {
+		return client
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if c.tlsConfig != nil {
+		transport.TLSClientConfig = c.tlsConfig
+	}
+	if c.proxy != nil {
+		transport.Proxy = http.ProxyURL(c.proxy)
+	}
+
+	copied := *client
+	copied.Transport = transport
+	return &copied
+}
+
+// dial opens a new websocket to the Hyperion endpoint, trying each Engine.IO version allowed by the Protocol until the server
+// accepts one.
+func (c *Client) dial(endpoint string) (*websocket.Conn, error) {
+	ctx := c.Ctx
+	if c.dialTimeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(c.Ctx, c.dialTimeout)
+		defer cancel()
+	}
+
+	var err error
+	for _, eio := range c.protocol.versions() {
+		var conn *websocket.Conn
+		var resp *http.Response
+		conn, resp, err = websocket.Dial(ctx, fmt.Sprintf("%s/socket.io/?EIO=%d&transport=websocket", endpoint, eio), &c.dialOpts)
+		if err == nil {
+			c.eio = eio
+			if c.skipOversize {
+				conn.SetReadLimit(-1)
+			} else {
+				conn.SetReadLimit(c.readLimit)
+			}
+			if eio == 4 {
+				if c.opening, err = c.connectNamespace(ctx, conn); err != nil {
+					_ = conn.Close(websocket.StatusNormalClosure, "")
+					return nil, err
+				}
+			}
+			return conn, nil
+		}
+		// servers reject an unsupported Engine.IO version with a bad request:
+		if resp == nil || resp.StatusCode != http.StatusBadRequest {
+			break
+		}
+	}
+	return nil, err
+}
+
+// connectNamespace completes the Engine.IO v4 handshake, where socket.io drops events until the client has connected
+// to the namespace. It waits for the open packet, sends the namespace connect, and returns the open packet for the
+// heartbeat once Hyperion acknowledges the connect. Without WithDialTimeout it waits up to the ack timeout.
+func (c *Client) connectNamespace(ctx context.Context, conn *websocket.Conn) ([]byte, error) {
+	if c.dialTimeout <= 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.ackTimeout)
+		defer cancel()
+	}
+	var open []byte
+	for {
+		mtype, m, err := conn.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if mtype != websocket.MessageText || len(m) == 0 {
+			continue
+		}
+		switch {
+		case m[0] == '0':
+			open = m
+			if err = conn.Write(ctx, websocket.MessageText, []byte("40")); err != nil {
+				return nil, err
+			}
+		case m[0] == '2':
+			if err = conn.Write(ctx, websocket.MessageText, []byte("3")); err != nil {
+				return nil, err
+			}
+		case len(m) >= 2 && string(m[:2]) == "44":
+			return nil, parseConnectError(m)
+		case len(m) >= 2 && string(m[:2]) == "40" && open != nil:
+			return open, nil
+		}
+	}
+}
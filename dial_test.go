@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"nhooyr.io/websocket"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDialTLS(t *testing.T) {
+	f := newFakeHyperionTLS(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+
+	if _, err := NewClient(f.url(), results, errs, WithDialTimeout(time.Second)); err == nil {
+		t.Fatal("expected an untrusted certificate to fail")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(f.srv.Certificate())
+	c, err := NewClient(f.url(), results, errs,
+		WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}),
+		WithHeader("X-Api-Key", "secret"),
+		WithHeader("X-Api-Key", "other"),
+		WithSubprotocols("echo", "socket.io"),
+		WithCompression(websocket.CompressionNoContextTakeover, 256),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	h := <-f.headers
+	if keys := h.Values("X-Api-Key"); len(keys) != 2 || keys[0] != "secret" {
+		t.Errorf("expected api key headers, got %v", keys)
+	}
+	if h.Get("Sec-Websocket-Protocol") != "echo,socket.io" {
+		t.Errorf("expected subprotocols, got %q", h.Get("Sec-Websocket-Protocol"))
+	}
+	if !strings.HasPrefix(h.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+		t.Errorf("expected compression to be offered, got %q", h.Get("Sec-Websocket-Extensions"))
+	}
+	f.accept(t)
+}
+
+func TestDialHTTPClient(t *testing.T) {
+	f := newFakeHyperionTLS(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithHTTPClient(f.srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	f.accept(t)
+}
+
+func TestDialProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.Host
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	if _, err = NewClient("ws://hyperion.example:7001", results, errs, WithProxy(proxyURL)); err == nil {
+		t.Error("expected the proxy to reject the request")
+	}
+	select {
+	case host := <-proxied:
+		if host != "hyperion.example:7001" {
+			t.Errorf("proxy received request for %q", host)
+		}
+	default:
+		t.Error("request was not sent to the proxy")
+	}
+}
@@ -0,0 +1,646 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Predicate is a compiled expression that decides whether a trace is delivered to a Subscription, see Compile.
+type Predicate struct {
+	expr string
+	root exprNode
+}
+
+// Compile parses a predicate expression, which compares the fields of a trace with literals. For example:
+//
+//	data.bounty > 1.0 TLM && data.planet_name in ["magor.world", "neri.world"]
+//
+// Fields are "data." followed by the path to a field in Act.Data or the delta's row, or one of: account, name,
+// block_num, global_sequence, producer, trx_id, timestamp and elapsed for actions, and code, scope, table,
+// primary_key, payer, present, block_num and timestamp for deltas. Hyperion's "act." prefix may also be used, as in
+// act.name or act.data.to. A field that a trace doesn't have is null.
+//
+// Literals are numbers, assets such as 1.0 TLM, strings in single or double quotes, true, false and null. Comparisons
+// are ==, !=, <, <=, > and >=, and "in" tests if a field equals any literal in a list. They are combined with &&, ||
+// and !, and parentheses. Numbers sent as strings are compared as numbers, and assets are only compared with assets
+// of the same symbol, regardless of precision. Every comparison between values that can't be compared, such as a
+// string and a boolean or assets of different symbols, is false, including !=. A missing field can only be compared
+// with null, so data.x != null tests whether x is present.
+func Compile(expr string) (*Predicate, error) {
+	p := &exprParser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEnd {
+		return nil, p.errorAt(tok, "unexpected "+tok.text)
+	}
+	return &Predicate{expr: expr, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression is invalid, for use with constant expressions.
+func MustCompile(expr string) *Predicate {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match reports whether a trace satisfies the predicate, fork events never do.
+func (p *Predicate) Match(resp HyperionResponse) bool {
+	switch resp.(type) {
+	case *ActionTrace, *DeltaTrace:
+		return p.root.eval(resp)
+	}
+	return false
+}
+
+// String returns the expression the Predicate was compiled from.
+func (p *Predicate) String() string {
+	return p.expr
+}
+
+// Matching sets a predicate that each trace must satisfy to be delivered, in addition to the request's filters. It
+// is evaluated by the Client since Hyperion's filters only test a single field for equality. Subscriptions whose
+// requests differ only in their predicates are identical to Hyperion, so subscribing to both returns a BusyError.
+func (ar *ActionsReq) Matching(p *Predicate) *ActionsReq {
+	ar.Predicate = p
+	return ar
+}
+
+// Matching sets a predicate that each table update must satisfy to be delivered, see ActionsReq.Matching.
+func (dr *DeltasReq) Matching(p *Predicate) *DeltasReq {
+	dr.Predicate = p
+	return dr
+}
+
+// SetPredicate replaces the predicate of an active Subscription, a nil predicate delivers every matching trace.
+func (c *Client) SetPredicate(s *Subscription, p *Predicate) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	s.predicate = p
+}
+
+// PredicateStats counts the traces a Subscription's predicate matched and rejected. Traces discarded as duplicates
+// or after Unsubscribe are not counted.
+type PredicateStats struct {
+	Matched  uint64
+	Rejected uint64
+}
+
+// PredicateStats returns the Subscription's predicate counters, which are zero if it has no predicate.
+func (s *Subscription) PredicateStats() PredicateStats {
+	return PredicateStats{Matched: s.matched.Load(), Rejected: s.rejected.Load()}
+}
+
+// requestPredicate is the predicate set on the subscription's request.
+func (s *Subscription) requestPredicate() *Predicate {
+	switch {
+	case s.Actions != nil:
+		return s.Actions.Predicate
+	case s.Deltas != nil:
+		return s.Deltas.Predicate
+	}
+	return nil
+}
+
+// accepts evaluates the subscription's predicate against a trace and counts the result. The caller must hold c.mux.
+func (s *Subscription) accepts(resp HyperionResponse) bool {
+	if s.predicate == nil {
+		return true
+	}
+	if !s.predicate.Match(resp) {
+		s.rejected.Add(1)
+		return false
+	}
+	s.matched.Add(1)
+	return true
+}
+
+// ExprError is returned by Compile for an invalid expression, Pos is the byte offset of the problem.
+type ExprError struct {
+	Expr    string
+	Pos     int
+	Message string
+}
+
+// Error satisfies the error interface
+func (ee ExprError) Error() string {
+	return fmt.Sprintf("invalid expression %q at %d: %s", ee.Expr, ee.Pos, ee.Message)
+}
+
+type tokenKind uint8
+
+const (
+	tokEnd tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	expr   string
+	tokens []token
+	next   int
+}
+
+func (p *exprParser) errorAt(tok token, msg string) error {
+	return ExprError{Expr: p.expr, Pos: tok.pos, Message: msg}
+}
+
+// tokenize splits the expression into identifiers, numbers, strings and operators.
+func (p *exprParser) tokenize() error {
+	s := p.expr
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(s) && rune(s[end]) != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return ExprError{Expr: s, Pos: i, Message: "unterminated string"}
+			}
+			quoted := s[i : end+1]
+			if c == '\'' {
+				quoted = `"` + strings.ReplaceAll(strings.ReplaceAll(quoted[1:len(quoted)-1], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			text, err := strconv.Unquote(quoted)
+			if err != nil {
+				return ExprError{Expr: s, Pos: i, Message: "invalid string"}
+			}
+			p.tokens = append(p.tokens, token{kind: tokString, text: text, pos: i})
+			i = end + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			end := i + 1
+			for end < len(s) && (unicode.IsDigit(rune(s[end])) || s[end] == '.') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, text: s[i:end], pos: i})
+			i = end
+		case unicode.IsLetter(c) || c == '_' || c == '@':
+			end := i + 1
+			for end < len(s) && (unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end])) || s[end] == '_' || s[end] == '.') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: s[i:end], pos: i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return ExprError{Expr: s, Pos: i, Message: fmt.Sprintf("unexpected %q", c)}
+			}
+			p.tokens = append(p.tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEnd, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) take() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEnd {
+		p.next++
+	}
+	return tok
+}
+
+func (p *exprParser) or() (exprNode, error) {
+	left, err := p.and()
+	for err == nil && p.peek().text == "||" && p.peek().kind == tokOp {
+		p.take()
+		var right exprNode
+		if right, err = p.and(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	left, err := p.unary()
+	for err == nil && p.peek().text == "&&" && p.peek().kind == tokOp {
+		p.take()
+		var right exprNode
+		if right, err = p.unary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	tok := p.peek()
+	if tok.kind == tokOp && tok.text == "!" {
+		p.take()
+		inner, err := p.unary()
+		return notNode{inner}, err
+	}
+	if tok.kind == tokOp && tok.text == "(" {
+		p.take()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokOp || closing.text != ")" {
+			return nil, p.errorAt(closing, "expected )")
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses a field compared with a literal, a field tested against a list, or a field on its own which is
+// true if it holds true.
+func (p *exprParser) comparison() (exprNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	switch {
+	case tok.kind == tokIdent && tok.text == "in":
+		p.take()
+		list, err := p.list()
+		return inNode{left, list}, err
+	case tok.kind == tokOp && compareOps[tok.text]:
+		p.take()
+		right, err := p.operand()
+		return compareNode{op: tok.text, left: left, right: right}, err
+	}
+	return compareNode{op: "==", left: left, right: literalOperand{exprValue{kind: valueBool, b: true}}}, nil
+}
+
+func (p *exprParser) list() ([]exprValue, error) {
+	if open := p.take(); open.kind != tokOp || open.text != "[" {
+		return nil, p.errorAt(open, "expected [")
+	}
+	values := make([]exprValue, 0)
+	for {
+		lit, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, lit)
+		sep := p.take()
+		switch {
+		case sep.kind == tokOp && sep.text == ",":
+		case sep.kind == tokOp && sep.text == "]":
+			return values, nil
+		default:
+			return nil, p.errorAt(sep, "expected , or ]")
+		}
+	}
+}
+
+func (p *exprParser) operand() (operand, error) {
+	tok := p.peek()
+	if tok.kind == tokIdent && !isKeyword(tok.text) {
+		p.take()
+		path := strings.Split(tok.text, ".")
+		if path[0] == "act" && len(path) > 1 {
+			path = path[1:]
+		}
+		if path[0] == "@timestamp" {
+			path[0] = "timestamp"
+		}
+		for _, segment := range path {
+			if segment == "" {
+				return nil, p.errorAt(tok, "invalid field "+tok.text)
+			}
+		}
+		if !knownRoots[path[0]] || (path[0] == "data") != (len(path) > 1) {
+			return nil, p.errorAt(tok, "unknown field "+tok.text)
+		}
+		return fieldOperand(path), nil
+	}
+	lit, err := p.literal()
+	return literalOperand{lit}, err
+}
+
+func isKeyword(s string) bool {
+	return s == "true" || s == "false" || s == "null" || s == "in"
+}
+
+// literal parses a number, asset, string, boolean or null.
+func (p *exprParser) literal() (exprValue, error) {
+	tok := p.take()
+	switch tok.kind {
+	case tokString:
+		return exprValue{kind: valueString, s: tok.text}, nil
+	case tokNumber:
+		n, ok := new(big.Rat).SetString(tok.text)
+		if !ok {
+			return exprValue{}, p.errorAt(tok, "invalid number "+tok.text)
+		}
+		if sym := p.peek(); sym.kind == tokIdent && isSymbol(sym.text) {
+			p.take()
+			return exprValue{kind: valueAsset, n: n, s: sym.text}, nil
+		}
+		return exprValue{kind: valueNumber, n: n}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return exprValue{kind: valueBool, b: tok.text == "true"}, nil
+		case "null":
+			return exprValue{kind: valueNull, literal: true}, nil
+		}
+	}
+	return exprValue{}, p.errorAt(tok, "expected a value, got "+tok.text)
+}
+
+// isSymbol checks for an asset's symbol, which is up to seven upper case letters.
+func isSymbol(s string) bool {
+	if len(s) == 0 || len(s) > 7 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// knownRoots are the fields that may be used in an expression.
+var knownRoots = map[string]bool{
+	"data": true, "account": true, "name": true, "block_num": true, "global_sequence": true, "producer": true,
+	"trx_id": true, "timestamp": true, "elapsed": true, "code": true, "scope": true, "table": true,
+	"primary_key": true, "payer": true, "present": true,
+}
+
+type exprNode interface {
+	eval(resp HyperionResponse) bool
+}
+
+type orNode struct{ left, right exprNode }
+
+func (n orNode) eval(resp HyperionResponse) bool { return n.left.eval(resp) || n.right.eval(resp) }
+
+type andNode struct{ left, right exprNode }
+
+func (n andNode) eval(resp HyperionResponse) bool { return n.left.eval(resp) && n.right.eval(resp) }
+
+type notNode struct{ inner exprNode }
+
+func (n notNode) eval(resp HyperionResponse) bool { return !n.inner.eval(resp) }
+
+type compareNode struct {
+	op          string
+	left, right operand
+}
+
+func (n compareNode) eval(resp HyperionResponse) bool {
+	a, b := n.left.value(resp), n.right.value(resp)
+	if n.op == "==" || n.op == "!=" {
+		eq, ok := a.equal(b)
+		return ok && eq == (n.op == "==")
+	}
+	cmp, ok := a.compare(b)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+type inNode struct {
+	left operand
+	list []exprValue
+}
+
+func (n inNode) eval(resp HyperionResponse) bool {
+	v := n.left.value(resp)
+	for _, candidate := range n.list {
+		if eq, _ := v.equal(candidate); eq {
+			return true
+		}
+	}
+	return false
+}
+
+type operand interface {
+	value(resp HyperionResponse) exprValue
+}
+
+type literalOperand struct{ v exprValue }
+
+func (l literalOperand) value(HyperionResponse) exprValue { return l.v }
+
+type fieldOperand []string
+
+// value looks up the field on the trace.
+func (f fieldOperand) value(resp HyperionResponse) exprValue {
+	var v interface{}
+	switch r := resp.(type) {
+	case *ActionTrace:
+		switch f[0] {
+		case "data":
+			v = lookupPath(r.Act.Data, f[1:])
+		case "account":
+			v = string(r.Act.Account)
+		case "name":
+			v = string(r.Act.Name)
+		case "block_num":
+			v = r.BlockNum
+		case "global_sequence":
+			v = r.GlobalSequence
+		case "producer":
+			v = string(r.Producer)
+		case "trx_id":
+			v = r.TrxId.String()
+		case "timestamp":
+			v = r.TS
+		case "elapsed":
+			v = r.Elapsed
+		}
+	case *DeltaTrace:
+		switch f[0] {
+		case "data":
+			v = lookupPath(r.Data, f[1:])
+		case "code":
+			v = string(r.Code)
+		case "scope":
+			v = string(r.Scope)
+		case "table":
+			v = string(r.Table)
+		case "primary_key":
+			v = r.PrimaryKey
+		case "payer":
+			v = string(r.Payer)
+		case "present":
+			v = r.Present
+		case "block_num":
+			v = r.BlockNum
+		case "timestamp":
+			v = r.TS
+		}
+	}
+	return valueOf(v)
+}
+
+func lookupPath(v interface{}, path []string) interface{} {
+	for _, k := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+type valueKind uint8
+
+const (
+	valueNull valueKind = iota
+	valueBool
+	valueNumber
+	valueString
+	valueAsset
+	valueOther
+)
+
+// exprValue is a literal or the value of a field, an asset has its amount in n and symbol in s. literal is set for
+// the null literal, which any value can be compared with.
+type exprValue struct {
+	kind    valueKind
+	b       bool
+	n       *big.Rat
+	s       string
+	literal bool
+}
+
+// valueOf converts a decoded JSON value, or a trace field, for comparison.
+func valueOf(v interface{}) exprValue {
+	switch x := v.(type) {
+	case nil:
+		return exprValue{kind: valueNull}
+	case bool:
+		return exprValue{kind: valueBool, b: x}
+	case string:
+		return exprValue{kind: valueString, s: x}
+	case float64:
+		// the shortest decimal form, so that 0.1 in JSON equals the literal 0.1:
+		if n, ok := new(big.Rat).SetString(strconv.FormatFloat(x, 'g', -1, 64)); ok {
+			return exprValue{kind: valueNumber, n: n}
+		}
+	case json.Number:
+		// from a trace normalized by an AbiRegistry
+		if n, ok := new(big.Rat).SetString(x.String()); ok {
+			return exprValue{kind: valueNumber, n: n}
+		}
+	case uint32:
+		return exprValue{kind: valueNumber, n: new(big.Rat).SetUint64(uint64(x))}
+	case uint64:
+		return exprValue{kind: valueNumber, n: new(big.Rat).SetUint64(x)}
+	}
+	return exprValue{kind: valueOther}
+}
+
+// number returns the value as a number, parsing strings since Hyperion sends large integers as strings.
+func (v exprValue) number() (*big.Rat, bool) {
+	switch v.kind {
+	case valueNumber:
+		return v.n, true
+	case valueString:
+		return new(big.Rat).SetString(strings.TrimSpace(v.s))
+	}
+	return nil, false
+}
+
+// asset returns the value as an asset's amount and symbol, parsing strings such as "1.0000 TLM".
+func (v exprValue) asset() (*big.Rat, string, bool) {
+	switch v.kind {
+	case valueAsset:
+		return v.n, v.s, true
+	case valueString:
+		amount, symbol, found := strings.Cut(strings.TrimSpace(v.s), " ")
+		if !found || !isSymbol(symbol) {
+			return nil, "", false
+		}
+		n, ok := new(big.Rat).SetString(amount)
+		return n, symbol, ok
+	}
+	return nil, "", false
+}
+
+// equal reports whether two values are equal, ok is false if they can't be compared.
+func (v exprValue) equal(o exprValue) (eq bool, ok bool) {
+	if cmp, ok := v.compare(o); ok {
+		return cmp == 0, true
+	}
+	switch {
+	case v.kind == valueBool && o.kind == valueBool:
+		return v.b == o.b, true
+	case v.kind == valueNull || o.kind == valueNull:
+		// comparing with the null literal tests whether a field is present, a missing field can't be compared with
+		// anything else:
+		return v.kind == o.kind, v.kind == o.kind || v.literal || o.literal
+	}
+	return false, false
+}
+
+// compare orders two values, ok is false if they can't be compared.
+func (v exprValue) compare(o exprValue) (cmp int, ok bool) {
+	switch {
+	case v.kind == valueAsset || o.kind == valueAsset:
+		a, symA, okA := v.asset()
+		b, symB, okB := o.asset()
+		if !okA || !okB || symA != symB {
+			return 0, false
+		}
+		return a.Cmp(b), true
+	case v.kind == valueNumber || o.kind == valueNumber:
+		a, okA := v.number()
+		b, okB := o.number()
+		if !okA || !okB {
+			return 0, false
+		}
+		return a.Cmp(b), true
+	case v.kind == valueString && o.kind == valueString:
+		return strings.Compare(v.s, o.s), true
+	}
+	return 0, false
+}
@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPredicateAction(t *testing.T) {
+	a := &ActionTrace{BlockNum: 120, GlobalSequence: 9001, Elapsed: "42", TS: "2021-01-28T19:37:19.000"}
+	a.Act.Account = "m.federation"
+	a.Act.Name = "logmine"
+	a.Act.Data = map[string]interface{}{
+		"miner":       "4hhqy.wam",
+		"bounty":      "2.5000 TLM",
+		"planet_name": "magor.world",
+		"land_id":     "1099512960752",
+		"params":      map[string]interface{}{"delay": float64(450), "invalid": false, "ratio": 0.1, "mult": 1.1},
+		"units":       json.Number("3"),
+	}
+
+	for expr, want := range map[string]bool{
+		`data.bounty > 1.0 TLM && data.planet_name in ["magor.world", "neri.world"]`: true,
+		`data.bounty > 2.5 TLM`:                                 false,
+		`data.bounty >= 2.5 TLM`:                                true,
+		`data.bounty == 2.5 TLM`:                                true,
+		`data.bounty > 1.0 WAX`:                                 false,
+		`data.bounty != 1.0 WAX`:                                false,
+		`data.bounty != 1.0 TLM`:                                true,
+		`data.params.ratio == 0.1`:                              true,
+		`data.params.ratio in [0.2, 0.1]`:                       true,
+		`data.params.mult <= 1.1 && data.params.mult >= 1.1`:    true,
+		`data.params.mult > 1.1`:                                false,
+		`data.params.ratio != 0.1`:                              false,
+		`data.missing != 5`:                                     false,
+		`data.missing != null`:                                  false,
+		`data.miner != null`:                                    true,
+		`data.miner != true`:                                    false,
+		`data.bounty > 1`:                                       false,
+		`data.land_id == 1099512960752`:                         true,
+		`data.land_id < 1099512960752`:                          false,
+		`data.params.delay <= 450 && data.params.delay > 449.5`: true,
+		`data.params.invalid`:                                   false,
+		`!data.params.invalid`:                                  true,
+		`data.params.invalid == false`:                          true,
+		`data.units == 3`:                                       true,
+		`data.missing == null`:                                  true,
+		`data.missing > 0`:                                      false,
+		`data.miner == '4hhqy.wam'`:                             true,
+		`data.miner < "5"`:                                      true,
+		`act.account == "m.federation" && name == "logmine"`:    true,
+		`block_num > 100 && global_sequence == 9001`:            true,
+		`elapsed < 100`:                                         true,
+		`@timestamp >= "2021-01-28"`:                            true,
+		`code == "m.federation"`:                                false,
+		`code == null`:                                          true,
+		`data.planet_name == "neri.world" || (data.bounty > 2 TLM && !(data.miner in ["bob"]))`: true,
+		`data.planet_name == "neri.world" || data.bounty > 2 TLM && data.miner in ["bob"]`:      false,
+	} {
+		p, err := Compile(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := p.Match(a); got != want {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+}
+
+func TestPredicateDelta(t *testing.T) {
+	d := &DeltaTrace{Code: "eosio.token", Scope: "alice", Table: "accounts", PrimaryKey: "5459781", Present: true, BlockNum: 7}
+	d.Data = map[string]interface{}{"balance": "10.0000 EOS"}
+
+	for expr, want := range map[string]bool{
+		`table == "accounts" && scope in ["alice", "bob"] && present`: true,
+		`data.balance < 100 EOS && primary_key == 5459781`:            true,
+		`!present || block_num != 7`:                                  false,
+		`name == "transfer"`:                                          false,
+	} {
+		if got := MustCompile(expr).Match(d); got != want {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+	if MustCompile(`true`).Match(&ForkEvent{}) {
+		t.Error("fork events should never match")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for expr, pos := range map[string]int{
+		``:                       0,
+		`data.bounty >`:          13,
+		`data.bounty > 1 TLM &&`: 22,
+		`data >= 1`:              0,
+		`data..x == 1`:           0,
+		`act.foo == 1`:           0,
+		`data.x == "open`:        10,
+		`data.x in ["a" "b"]`:    15,
+		`data.x in "a"`:          10,
+		`(data.x == 1`:           12,
+		`data.x == 1)`:           11,
+		`data.x = 1`:             7,
+		`data.x == data.y ==  1`: 17,
+		`data.x in [1, data.y]`:  14,
+		`data.x == 1.2.3`:        10,
+	} {
+		_, err := Compile(expr)
+		var ee ExprError
+		if !errors.As(err, &ee) || ee.Pos != pos {
+			t.Errorf("%q: expected an ExprError at %d, got %v", expr, pos, err)
+		}
+	}
+}
+
+func TestSubscriptionPredicate(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse, 16)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	mined := make(chan HyperionResponse, 16)
+	req := NewActionsReq("m.federation", "", "logmine").Matching(MustCompile(`data.bounty > 1.0 TLM`))
+	s, err := c.SubscribeActions(context.Background(), req, mined)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, logMineFrame(t, 1, "0.5000 TLM"))
+	fc.send(t, logMineFrame(t, 2, "2.0000 TLM"))
+	fc.send(t, logMineFrame(t, 3, "0.9999 TLM"))
+	fc.send(t, logMineFrame(t, 4, "3.0000 TLM"))
+	for _, want := range []uint64{2, 4} {
+		select {
+		case resp := <-mined:
+			if a, _ := resp.Action(); a == nil || a.GlobalSequence != want {
+				t.Errorf("expected action %d, got %+v", want, resp)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for action %d", want)
+		}
+	}
+	if stats := s.PredicateStats(); stats.Matched != 2 || stats.Rejected != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// replacing the predicate applies to the traces that follow, and rejected traces are not sent to the Client's
+	// results channel:
+	c.SetPredicate(s, MustCompile(`data.bounty < 1.0 TLM`))
+	fc.send(t, logMineFrame(t, 5, "5.0000 TLM"))
+	fc.send(t, logMineFrame(t, 6, "0.1000 TLM"))
+	select {
+	case resp := <-mined:
+		if a, _ := resp.Action(); a == nil || a.GlobalSequence != 6 {
+			t.Errorf("expected action 6, got %+v", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for action 6")
+	}
+	select {
+	case resp := <-results:
+		t.Errorf("unexpected result %+v", resp)
+	default:
+	}
+	if stats := s.PredicateStats(); stats.Matched != 3 || stats.Rejected != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
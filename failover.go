@@ -0,0 +1,189 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"nhooyr.io/websocket"
+	"strings"
+	"time"
+)
+
+// healthCheckTimeout limits each health check unless WithDialTimeout is shorter.
+const healthCheckTimeout = 10 * time.Second
+
+// NewFailoverClient is the same as NewClientWithContext, but accepts several Hyperion endpoints in order of
+// preference. The most preferred endpoint that passes its health check and can be dialed is used. When its websocket
+// fails, or is idle for longer than WithIdleTimeout allows, the Client fails over to the next healthy endpoint and
+// resumes each subscription from the last block delivered, and stays there until that endpoint fails in turn.
+//
+// Failing over uses DefaultBackoff unless WithReconnect is also supplied, and each switch is reported in
+// ReconnectedError.Endpoint. ActiveEndpoint returns the endpoint in use.
+func NewFailoverClient(ctx context.Context, endpoints []string, results chan HyperionResponse, errors chan error, opts ...Option) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints were supplied")
+	}
+	trimmed := make([]string, len(endpoints))
+	for i := range endpoints {
+		trimmed[i] = strings.TrimRight(endpoints[i], "/")
+	}
+	defaults := []Option{
+		WithReconnect(DefaultBackoff),
+		func(c *Client) {
+			c.endpoints = trimmed
+			c.healthCheck = c.checkHealth
+		},
+	}
+	return NewClientWithContext(ctx, endpoints[0], results, errors, append(defaults, opts...)...)
+}
+
+// WithHealthCheck replaces the check made before a failover Client connects to an endpoint, it is passed the
+// endpoint's websocket url and should return an error if the endpoint is not fit to stream from. A nil check
+// disables health checks. The default queries Hyperion's /v2/health API, see CheckHealth.
+func WithHealthCheck(check func(ctx context.Context, endpoint string) error) Option {
+	return func(c *Client) {
+		c.healthCheck = check
+	}
+}
+
+// WithIdleTimeout considers the websocket failed if no events are received from Hyperion for d, which will cause a
+// reconnect when using WithReconnect, or a failover with NewFailoverClient. Hyperion sends lib_update events as the
+// chain progresses, so a healthy stream is never idle for long even if no traces match.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.idleTimeout = d
+	}
+}
+
+// ActiveEndpoint returns the url of the Hyperion endpoint the Client is connected to, or was last connected to
+// while it is reconnecting.
+func (c *Client) ActiveEndpoint() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.url
+}
+
+// connect dials Hyperion. A failover Client tries each healthy endpoint in order of preference, trying the endpoint
+// that just failed last.
+func (c *Client) connect(failed string) (string, *websocket.Conn, error) {
+	if len(c.endpoints) == 0 {
+		conn, err := c.dial(c.url)
+		return c.url, conn, err
+	}
+
+	candidates := make([]string, 0, len(c.endpoints))
+	for _, endpoint := range c.endpoints {
+		if endpoint != failed {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if len(candidates) < len(c.endpoints) {
+		candidates = append(candidates, failed)
+	}
+
+	var err error
+	for _, endpoint := range candidates {
+		if c.healthCheck != nil {
+			if err = c.checkEndpoint(endpoint); err != nil {
+				err = EndpointError{Endpoint: endpoint, Err: err}
+				continue
+			}
+		}
+		var conn *websocket.Conn
+		if conn, err = c.dial(endpoint); err != nil {
+			err = EndpointError{Endpoint: endpoint, Err: err}
+			continue
+		}
+		return endpoint, conn, nil
+	}
+	return "", nil, err
+}
+
+// checkEndpoint runs the health check with a timeout.
+func (c *Client) checkEndpoint(endpoint string) error {
+	timeout := healthCheckTimeout
+	if c.dialTimeout > 0 && c.dialTimeout < timeout {
+		timeout = c.dialTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.Ctx, timeout)
+	defer cancel()
+	return c.healthCheck(ctx, endpoint)
+}
+
+// checkHealth is the default health check, using the Client's http.Client.
+func (c *Client) checkHealth(ctx context.Context, endpoint string) error {
+	client := c.dialOpts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return CheckHealth(ctx, client, endpoint)
+}
+
+// CheckHealth queries the /v2/health API of the Hyperion endpoint, which may be given as a websocket or http url.
+// It fails if the request fails, or if any service reports an error.
+func CheckHealth(ctx context.Context, client *http.Client, endpoint string) error {
+	u := strings.TrimRight(endpoint, "/")
+	switch {
+	case strings.HasPrefix(u, "ws://"):
+		u = "http://" + strings.TrimPrefix(u, "ws://")
+	case strings.HasPrefix(u, "wss://"):
+		u = "https://" + strings.TrimPrefix(u, "wss://")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u+"/v2/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+
+	health := struct {
+		Health []struct {
+			Service string `json:"service"`
+			Status  string `json:"status"`
+		} `json:"health"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("invalid health check response: %w", err)
+	}
+	for _, s := range health.Health {
+		if strings.EqualFold(s.Status, "error") {
+			return fmt.Errorf("service %s is unhealthy", s.Service)
+		}
+	}
+	return nil
+}
+
+// EndpointError is returned when a failover Client could not use an endpoint, Err holds the reason.
+type EndpointError struct {
+	Endpoint string
+	Err      error
+}
+
+// Error satisfies the error interface
+func (e EndpointError) Error() string {
+	return fmt.Sprintf("endpoint %s: %v", e.Endpoint, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// IdleTimeoutError is returned when no events were received from Hyperion within the time allowed by
+// WithIdleTimeout, and the websocket was considered failed.
+type IdleTimeoutError struct {
+	Endpoint string
+	Timeout  time.Duration
+}
+
+// Error satisfies the error interface
+func (i IdleTimeoutError) Error() string {
+	return fmt.Sprintf("no events received from %s for %s", i.Endpoint, i.Timeout)
+}
@@ -0,0 +1,157 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFailoverSkipsUnhealthy(t *testing.T) {
+	primary, secondary := newFakeHyperion(t), newFakeHyperion(t)
+	primary.healthStatus = http.StatusServiceUnavailable
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewFailoverClient(context.Background(), []string{primary.url(), secondary.url() + "/"}, results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	secondary.accept(t)
+	if c.ActiveEndpoint() != secondary.url() {
+		t.Errorf("expected %s to be active, got %s", secondary.url(), c.ActiveEndpoint())
+	}
+
+	// without a health check the primary is used:
+	c2, err := NewFailoverClient(context.Background(), []string{primary.url(), secondary.url()}, results, errs, WithHealthCheck(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	primary.accept(t)
+	if c2.ActiveEndpoint() != primary.url() {
+		t.Errorf("expected %s to be active, got %s", primary.url(), c2.ActiveEndpoint())
+	}
+}
+
+func TestFailoverResumes(t *testing.T) {
+	primary, secondary := newFakeHyperion(t), newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewFailoverClient(context.Background(), []string{primary.url(), secondary.url()}, results, errs,
+		WithReconnect(Backoff{Initial: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fc := primary.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	fc.expectRequest(t, "action_stream_request")
+	fc.send(t, actionFrame(t, 10, 100))
+	nextResult(t, results)
+	fc.drop()
+
+	// the primary is still healthy, but just failed, so the secondary is preferred:
+	fc = secondary.accept(t)
+	ar := &ActionsReq{}
+	if err = json.Unmarshal([]byte(fc.expectRequest(t, "action_stream_request")), ar); err != nil {
+		t.Fatal(err)
+	}
+	if ar.StartFrom != float64(10) {
+		t.Errorf("expected resubscribe from block 10, got %v", ar.StartFrom)
+	}
+	fc.send(t, actionFrame(t, 10, 100))
+	fc.send(t, actionFrame(t, 11, 101))
+	if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != 101 {
+		t.Errorf("expected global sequence 101 after failover, got %+v", a)
+	}
+	if c.ActiveEndpoint() != secondary.url() {
+		t.Errorf("expected %s to be active, got %s", secondary.url(), c.ActiveEndpoint())
+	}
+
+	for len(errs) > 0 {
+		if r, ok := (<-errs).(ReconnectedError); ok {
+			if r.Endpoint != secondary.url() {
+				t.Errorf("expected failover to %s, got %s", secondary.url(), r.Endpoint)
+			}
+			return
+		}
+	}
+	t.Error("failover was not reported on the errors channel")
+}
+
+func TestFailoverIdle(t *testing.T) {
+	primary, secondary := newFakeHyperion(t), newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewFailoverClient(context.Background(), []string{primary.url(), secondary.url()}, results, errs,
+		WithReconnect(Backoff{Initial: 10 * time.Millisecond}),
+		WithIdleTimeout(200*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := primary.accept(t)
+
+	// events keep the connection alive:
+	for i := 0; i < 5; i++ {
+		fc.send(t, libFrame(uint32(i+1)))
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(errs) > 0 {
+		t.Fatal("unexpected error:", <-errs)
+	}
+
+	secondary.accept(t)
+	var idle IdleTimeoutError
+	if err = <-errs; !errors.As(err, &idle) {
+		t.Fatalf("expected an IdleTimeoutError, got %v", err)
+	}
+	if idle.Endpoint != primary.url() {
+		t.Errorf("expected %s to be idle, got %s", primary.url(), idle.Endpoint)
+	}
+}
+
+func TestFailoverNoEndpoints(t *testing.T) {
+	if _, err := NewFailoverClient(context.Background(), nil, nil, nil); err == nil {
+		t.Error("expected an error without endpoints")
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	f := newFakeHyperion(t)
+	ctx := context.Background()
+	if err := CheckHealth(ctx, http.DefaultClient, f.url()); err != nil {
+		t.Error("expected healthy:", err)
+	}
+
+	f.health = `{"health":[{"service":"Elasticsearch","status":"Error"}]}`
+	if err := CheckHealth(ctx, http.DefaultClient, f.srv.URL); err == nil {
+		t.Error("expected a failing service to be unhealthy")
+	}
+	f.health = `<html>`
+	if err := CheckHealth(ctx, http.DefaultClient, f.url()); err == nil {
+		t.Error("expected an invalid response to be unhealthy")
+	}
+	f.health = `{}`
+	f.healthStatus = http.StatusBadGateway
+	if err := CheckHealth(ctx, http.DefaultClient, f.url()); err == nil {
+		t.Error("expected a bad status to be unhealthy")
+	}
+}
+
+func TestEndpointErrors(t *testing.T) {
+	switch "" {
+	case EndpointError{Err: ExitError{}}.Error():
+		t.Error("err is empty")
+		fallthrough
+	case IdleTimeoutError{}.Error():
+		t.Error("err is empty")
+	}
+}
@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"fmt"
+	"github.com/eoscanada/eos-go"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayout is the format of Hyperion's @timestamp fields, which are in UTC without a zone.
+const timestampLayout = "2006-01-02T15:04:05.999999999"
+
+// parseTimestamp parses a Hyperion timestamp as UTC, a zone is also accepted in case Hyperion adds one.
+func parseTimestamp(field string, ts string) (time.Time, error) {
+	t, err := time.ParseInLocation(timestampLayout, ts, time.UTC)
+	if err != nil {
+		var zoned error
+		if t, zoned = time.Parse(time.RFC3339Nano, ts); zoned != nil {
+			return time.Time{}, ParseError{Field: field, Value: ts, Err: err}
+		}
+	}
+	return t.UTC(), nil
+}
+
+// parseUint parses a sequence sent as a string.
+func parseUint(field string, s string) (uint64, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, ParseError{Field: field, Value: s, Err: err}
+	}
+	return n, nil
+}
+
+// parseAsset parses an asset held in decoded trace data.
+func parseAsset(field string, data interface{}) (eos.Asset, error) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return eos.Asset{}, ParseError{Field: field, Err: fmt.Errorf("data is %T, not an object", data)}
+	}
+	s, ok := m[field].(string)
+	if !ok {
+		return eos.Asset{}, ParseError{Field: field, Value: fmt.Sprint(m[field]), Err: fmt.Errorf("expected a string")}
+	}
+	asset, err := eos.NewAssetFromString(s)
+	if err != nil {
+		return eos.Asset{}, ParseError{Field: field, Value: s, Err: err}
+	}
+	return asset, nil
+}
+
+// Time returns the block time of the trace in UTC.
+func (act *ActionTrace) Time() (time.Time, error) {
+	return parseTimestamp("@timestamp", act.TS)
+}
+
+// ElapsedDuration returns how long the action took to execute, which Hyperion sends as a string of microseconds.
+func (act *ActionTrace) ElapsedDuration() (time.Duration, error) {
+	us, err := strconv.ParseInt(strings.TrimSpace(act.Elapsed), 10, 64)
+	if err != nil {
+		return 0, ParseError{Field: "elapsed", Value: act.Elapsed, Err: err}
+	}
+	return time.Duration(us) * time.Microsecond, nil
+}
+
+// Asset parses the asset in a top level field of Act.Data, such as the quantity of a transfer.
+func (act *ActionTrace) Asset(field string) (eos.Asset, error) {
+	return parseAsset(field, act.Act.Data)
+}
+
+// Time returns the block time of the table update in UTC.
+func (d *DeltaTrace) Time() (time.Time, error) {
+	return parseTimestamp("@timestamp", d.TS)
+}
+
+// Asset parses the asset in a top level field of the table row, such as the balance in an accounts table.
+func (d *DeltaTrace) Asset(field string) (eos.Asset, error) {
+	return parseAsset(field, d.Data)
+}
+
+// GlobalSeq returns the receipt's global sequence as a number.
+func (r Receipt) GlobalSeq() (uint64, error) {
+	return parseUint("global_sequence", r.GlobalSequence)
+}
+
+// RecvSeq returns the receipt's receive sequence as a number.
+func (r Receipt) RecvSeq() (uint64, error) {
+	return parseUint("recv_sequence", r.RecvSequence)
+}
+
+// ParseError is returned when a field of a trace does not hold a valid value for its type.
+type ParseError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+// Error satisfies the error interface
+func (pe ParseError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %v", pe.Field, pe.Value, pe.Err)
+}
+
+// Unwrap returns the underlying parse error
+func (pe ParseError) Unwrap() error {
+	return pe.Err
+}
@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTraceTime(t *testing.T) {
+	for _, tc := range []struct {
+		ts   string
+		want time.Time
+		err  bool
+	}{
+		{ts: "2021-01-28T19:03:01.000", want: time.Date(2021, 1, 28, 19, 3, 1, 0, time.UTC)},
+		{ts: "2021-01-28T19:03:01.500", want: time.Date(2021, 1, 28, 19, 3, 1, 5e8, time.UTC)},
+		{ts: "2021-01-28T19:03:01", want: time.Date(2021, 1, 28, 19, 3, 1, 0, time.UTC)},
+		{ts: "2021-01-28T21:03:01.000+02:00", want: time.Date(2021, 1, 28, 19, 3, 1, 0, time.UTC)},
+		{ts: "", err: true},
+		{ts: "yesterday", err: true},
+	} {
+		got, err := (&ActionTrace{TS: tc.ts}).Time()
+		if tc.err {
+			var parseErr ParseError
+			if !errors.As(err, &parseErr) || parseErr.Field != "@timestamp" || parseErr.Value != tc.ts {
+				t.Errorf("%q: expected a ParseError, got %v", tc.ts, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.ts, err)
+			continue
+		}
+		if !got.Equal(tc.want) || got.Location() != time.UTC {
+			t.Errorf("%q: expected %v, got %v", tc.ts, tc.want, got)
+		}
+		if d, err := (&DeltaTrace{TS: tc.ts}).Time(); err != nil || !d.Equal(got) {
+			t.Errorf("%q: delta time should match the action's, got %v %v", tc.ts, d, err)
+		}
+	}
+}
+
+func TestElapsedDuration(t *testing.T) {
+	d, err := (&ActionTrace{Elapsed: "250"}).ElapsedDuration()
+	if err != nil || d != 250*time.Microsecond {
+		t.Errorf("expected 250µs, got %v %v", d, err)
+	}
+	if _, err = (&ActionTrace{Elapsed: "2.5ms"}).ElapsedDuration(); !errors.As(err, new(ParseError)) {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+}
+
+func TestReceiptSequences(t *testing.T) {
+	a := &ActionTrace{}
+	err := json.Unmarshal([]byte(`{"receipts":[{"receiver":"bob","global_sequence":"18446744073709551615","recv_sequence":"12","auth_sequence":[]}]}`), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global, err := a.Receipts[0].GlobalSeq()
+	if err != nil || global != 18446744073709551615 {
+		t.Errorf("unexpected global sequence %d: %v", global, err)
+	}
+	recv, err := a.Receipts[0].RecvSeq()
+	if err != nil || recv != 12 {
+		t.Errorf("unexpected recv sequence %d: %v", recv, err)
+	}
+	if _, err = (Receipt{RecvSequence: "-1"}).RecvSeq(); !errors.As(err, new(ParseError)) {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+}
+
+func TestTraceAsset(t *testing.T) {
+	a := &ActionTrace{}
+	a.Act.Data = map[string]interface{}{"quantity": "1.2500 EOS", "memo": "hi", "amount": float64(1)}
+	asset, err := a.Asset("quantity")
+	if err != nil || asset.Amount != 12500 || asset.Symbol.Symbol != "EOS" {
+		t.Errorf("unexpected asset %v: %v", asset, err)
+	}
+	for _, field := range []string{"memo", "amount", "missing"} {
+		if _, err = a.Asset(field); !errors.As(err, new(ParseError)) {
+			t.Errorf("%s: expected a ParseError, got %v", field, err)
+		}
+	}
+
+	d := &DeltaTrace{Data: map[string]interface{}{"balance": "10.00000000 WAX"}}
+	if asset, err = d.Asset("balance"); err != nil || asset.Precision != 8 {
+		t.Errorf("unexpected asset %v: %v", asset, err)
+	}
+	if _, err = (&DeltaTrace{Data: "0a0b"}).Asset("balance"); !errors.As(err, new(ParseError)) {
+		t.Errorf("expected a ParseError for undecoded data, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// FilterOp is how Hyperion combines the filters of an ActionsReq.
+type FilterOp string
+
+const (
+	// FilterAnd only streams actions matching every filter, this is Hyperion's default.
+	FilterAnd FilterOp = "and"
+	// FilterOr streams actions matching any of the filters.
+	FilterOr FilterOp = "or"
+)
+
+// Where adds a filter on field for each of values, for example Where("act.data.to", "alice", "bob"). Fields within
+// the action's data are given as "act.data." followed by the path to the field. Filters are checked by Validate,
+// which SubscribeActions calls before sending the request.
+//
+// Hyperion requires every filter to match unless MatchAny is used, so several values for a field other than
+// act.authorization.actor or act.authorization.permission need MatchAny. Hyperion applies a single FilterOp to every
+// filter, so a request can't require one field while allowing several values of another, such as from == x && to in
+// (a, b). Use a Predicate for that, see Compile.
+func (ar *ActionsReq) Where(field string, values ...string) *ActionsReq {
+	if len(values) == 0 {
+		// kept so that Validate reports it:
+		ar.AddFilter(&ReqFilter{Field: field})
+	}
+	for _, v := range values {
+		ar.AddFilter(&ReqFilter{Field: field, Value: v})
+	}
+	return ar
+}
+
+// MatchAny streams actions matching any of the filters, which is needed for a filter with several values unless the
+// field holds an array. It applies to every filter in the request.
+func (ar *ActionsReq) MatchAny() *ActionsReq {
+	ar.FilterOp = FilterOr
+	return ar
+}
+
+// MatchAll streams actions matching every filter.
+func (ar *ActionsReq) MatchAll() *ActionsReq {
+	ar.FilterOp = FilterAnd
+	return ar
+}
+
+// WithoutDeltas asks Hyperion not to include the table deltas caused by each action.
+func (ar *ActionsReq) WithoutDeltas() *ActionsReq {
+	ar.IgnoreDeltas = true
+	return ar
+}
+
+// filterPath matches a dotted path of field names, the first of which may start with '@' as in @timestamp.
+var filterPath = regexp.MustCompile(`^@?[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// arrayFields are the filter fields holding an array in the action, which several filters may require at once.
+var arrayFields = map[string]bool{"act.authorization.actor": true, "act.authorization.permission": true}
+
+// Validate checks the request's filters are well formed: each must have a field and a value, fields must be dotted
+// paths, and "act.data." must be followed by the path to a field in the action's data. Unless using MatchAny, a field
+// other than those in arrayFields can't be given different values since no action could match them all.
+func (ar *ActionsReq) Validate() error {
+	switch ar.FilterOp {
+	case "", FilterAnd, FilterOr:
+	default:
+		return FilterError{Field: "filter_op", Value: string(ar.FilterOp), Reason: `must be "and" or "or"`}
+	}
+	values := make(map[string]string)
+	for i, f := range ar.Filters {
+		if f == nil {
+			return FilterError{Index: i, Reason: "filter is nil"}
+		}
+		fe := FilterError{Index: i, Field: f.Field, Value: f.Value}
+		first, repeated := values[f.Field]
+		switch {
+		case f.Field == "":
+			fe.Reason = "field is empty"
+		case f.Field == "act.data" || f.Field == "act.data.":
+			fe.Reason = "act.data must be followed by the path to a field"
+		case !filterPath.MatchString(f.Field):
+			fe.Reason = "field must be a dotted path such as act.data.to"
+		case f.Value == "":
+			fe.Reason = "value is empty"
+		case repeated && first != f.Value && ar.FilterOp != FilterOr && !arrayFields[f.Field]:
+			fe.Reason = fmt.Sprintf("conflicts with %q since every filter must match, see MatchAny", first)
+		default:
+			if !repeated {
+				values[f.Field] = f.Value
+			}
+			continue
+		}
+		return fe
+	}
+	return nil
+}
+
+// FilterError is returned by ActionsReq.Validate, and by SubscribeActions and StreamActions before a request with a
+// malformed filter is sent. Index is the position of the filter in ActionsReq.Filters.
+type FilterError struct {
+	Index  int
+	Field  string
+	Value  string
+	Reason string
+}
+
+// Error satisfies the error interface
+func (fe FilterError) Error() string {
+	if fe.Field == "filter_op" {
+		return fmt.Sprintf("invalid filter_op %q: %s", fe.Value, fe.Reason)
+	}
+	return fmt.Sprintf("invalid filter %d (%s=%q): %s", fe.Index, fe.Field, fe.Value, fe.Reason)
+}
@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFilterBuilder(t *testing.T) {
+	req := NewActionsReq("eosio.token", "", "transfer").
+		Where("act.data.to", "alice", "bob").
+		Where("act.authorization.actor", "carol").
+		MatchAny().
+		WithoutDeltas()
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := req.ToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Filters      []ReqFilter `json:"filters"`
+		FilterOp     string      `json:"filter_op"`
+		IgnoreDeltas bool        `json:"ignore_deltas"`
+	}
+	if err = json.Unmarshal(b, &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []ReqFilter{{"act.data.to", "alice"}, {"act.data.to", "bob"}, {"act.authorization.actor", "carol"}}
+	if len(body.Filters) != len(want) {
+		t.Fatalf("expected %d filters, got %s", len(want), b)
+	}
+	for i := range want {
+		if body.Filters[i] != want[i] {
+			t.Errorf("filter %d: expected %+v, got %+v", i, want[i], body.Filters[i])
+		}
+	}
+	if body.FilterOp != "or" || !body.IgnoreDeltas {
+		t.Errorf("unexpected flags: %s", b)
+	}
+
+	// the flags are left out of requests that don't use them:
+	b, _ = NewActionsReq("eosio.token", "", "transfer").ToJson()
+	var flags map[string]interface{}
+	if err = json.Unmarshal(b, &flags); err != nil || flags["filter_op"] != nil || flags["ignore_deltas"] != nil {
+		t.Errorf("unexpected flags: %s", b)
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	for _, tc := range []struct {
+		req    *ActionsReq
+		index  int
+		reason string
+	}{
+		{req: NewActionsReq("a", "", "").Where("act.data.to"), reason: "value is empty"},
+		{req: NewActionsReq("a", "", "").Where("", "bob"), reason: "field is empty"},
+		{req: NewActionsReq("a", "", "").Where("act.data", "bob"), reason: "act.data must be followed by the path to a field"},
+		{req: NewActionsReq("a", "", "").Where("act.data.", "bob"), reason: "act.data must be followed by the path to a field"},
+		{req: NewActionsReq("a", "", "").Where("act.data.to", "bob").Where("act.data..to", "bob"), index: 1, reason: "field must be a dotted path such as act.data.to"},
+		{req: NewActionsReq("a", "", "").Where("act.data.to ", "bob"), reason: "field must be a dotted path such as act.data.to"},
+	} {
+		err := tc.req.Validate()
+		var fe FilterError
+		if !errors.As(err, &fe) || fe.Index != tc.index || fe.Reason != tc.reason {
+			t.Errorf("%+v: expected %q at %d, got %v", tc.req.Filters, tc.reason, tc.index, err)
+		}
+	}
+
+	// several values for a field only match with MatchAny, unless the field holds an array:
+	req := NewActionsReq("a", "", "").Where("act.data.from", "carol").Where("act.data.to", "alice", "bob")
+	var conflict FilterError
+	if err := req.Validate(); !errors.As(err, &conflict) || conflict.Index != 2 || conflict.Value != "bob" {
+		t.Errorf("expected the second value to be rejected, got %v", err)
+	}
+	if err := req.MatchAll().Validate(); err == nil {
+		t.Error("expected the second value to be rejected with MatchAll")
+	}
+	if err := req.MatchAny().Validate(); err != nil {
+		t.Errorf("several values should be allowed with MatchAny: %v", err)
+	}
+	req = NewActionsReq("a", "", "").Where("act.data.to", "alice", "alice").Where("act.authorization.actor", "alice", "bob")
+	if err := req.Validate(); err != nil {
+		t.Errorf("repeated values and array fields should be allowed: %v", err)
+	}
+
+	req = NewActionsReq("a", "", "")
+	req.Filters = append(req.Filters, nil)
+	if err := req.Validate(); !errors.As(err, new(FilterError)) {
+		t.Errorf("expected a nil filter to be rejected, got %v", err)
+	}
+	req = NewActionsReq("a", "", "").Where("@timestamp", "2021-01-28T19:37:19.000")
+	req.FilterOp = "xor"
+	var fe FilterError
+	if err := req.Validate(); !errors.As(err, &fe) || fe.Field != "filter_op" {
+		t.Errorf("expected the filter_op to be rejected, got %v", err)
+	}
+	req.FilterOp = ""
+	if err := req.Validate(); err != nil {
+		t.Errorf("@timestamp should be a valid field: %v", err)
+	}
+}
+
+func TestFilterRejectedBeforeSending(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer").Where("act.data.to"))
+	if !errors.As(err, new(FilterError)) {
+		t.Fatalf("expected a FilterError, got %v", err)
+	}
+	if _, err = c.SubscribeActions(context.Background(), NewActionsReq("eosio.token", "", "transfer").Where("act.data.to", "bob"), nil); err != nil {
+		t.Fatal(err)
+	}
+	// the first request sent should be the valid one:
+	if body := fc.expectRequest(t, "action_stream_request"); !strings.Contains(body, `"value":"bob"`) {
+		t.Errorf("unexpected request %s", body)
+	}
+	select {
+	case m := <-fc.frames:
+		t.Errorf("only the valid request should be sent, got %s", m)
+	default:
+	}
+}
+
+func TestFilterOpMatches(t *testing.T) {
+	a := &ActionTrace{}
+	a.Act.Account = "eosio.token"
+	a.Act.Name = "transfer"
+	a.Act.Data = map[string]interface{}{"to": "bob"}
+
+	req := NewActionsReq("eosio.token", "", "transfer").Where("act.data.to", "alice", "bob")
+	if req.matches(a) {
+		t.Error("both values should be required by default")
+	}
+	if !req.MatchAny().matches(a) {
+		t.Error("either value should match with MatchAny")
+	}
+	if NewActionsReq("eosio.token", "", "transfer").Where("act.data.to", "alice", "carol").MatchAny().matches(a) {
+		t.Error("neither value should match")
+	}
+}
@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// ForkEvent is sent by Hyperion when a microfork has replaced blocks StartingBlock through EndingBlock, NewId is the
+// id of the block that replaced them. Any actions or deltas already received from those blocks were orphaned and
+// should be undone, the replacement traces will follow.
+type ForkEvent struct {
+	ChainId       string `json:"chain_id"`
+	StartingBlock uint32 `json:"starting_block"`
+	EndingBlock   uint32 `json:"ending_block"`
+	NewId         string `json:"new_id"`
+
+	// Raw is the body of the fork_event, encoded again from the socket.io message it was sent in.
+	Raw json.RawMessage `json:"-"`
+
+	envelope Envelope
+}
+
+// decodeFork converts the body of a fork_event, Hyperion nests the block range in a data object alongside the chain
+// id, but a flat object is also accepted.
+func decodeFork(body interface{}) ([]HyperionResponse, error) {
+	msg, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	f := &ForkEvent{envelope: Envelope{Type: "fork_event", Mode: RespModeLive, Extra: make(map[string]interface{})}}
+	f.ChainId, _ = msg["chain_id"].(string)
+	fields := msg
+	if data, ok := msg["data"].(map[string]interface{}); ok {
+		fields = data
+	}
+	for k, v := range msg {
+		switch k {
+		case "chain_id", "data", "starting_block", "ending_block", "new_id":
+		default:
+			f.envelope.Extra[k] = v
+		}
+	}
+
+	var err error
+	if f.StartingBlock, err = forkBlock(fields["starting_block"]); err != nil {
+		return nil, err
+	}
+	if f.EndingBlock, err = forkBlock(fields["ending_block"]); err != nil {
+		return nil, err
+	}
+	f.NewId, _ = fields["new_id"].(string)
+	if f.StartingBlock == 0 {
+		return nil, nil
+	}
+	if f.Raw, err = json.Marshal(body); err != nil {
+		return nil, err
+	}
+	return []HyperionResponse{f}, nil
+}
+
+// forkBlock accepts a block number sent as either a JSON number or string.
+func forkBlock(v interface{}) (uint32, error) {
+	switch n := v.(type) {
+	case float64:
+		return uint32(n), nil
+	case string:
+		block, err := strconv.ParseUint(n, 10, 32)
+		return uint32(block), err
+	}
+	return 0, nil
+}
+
+// rollback handles a fork. When using WithIrreversibleOnly, held traces from the orphaned blocks are discarded and
+// nothing is delivered since no reversible data was sent. Otherwise each subscription is rewound so the replacement
+// traces are not mistaken for duplicates, and the ForkEvent is sent once over the results channel of every active
+// subscription. The Client's results channel only receives it if a subscription uses it or there are none, since it
+// may never be read when every subscription has a channel of its own. It returns false if the Client was cancelled.
+func (c *Client) rollback(f *ForkEvent) bool {
+	if b := c.irreversible; b != nil {
+		kept := b.traces[:0]
+		for _, t := range b.traces {
+			if blockNum(t) < f.StartingBlock {
+				kept = append(kept, t)
+			}
+		}
+		for i := len(kept); i < len(b.traces); i++ {
+			b.traces[i] = nil
+		}
+		b.traces = kept
+		return true
+	}
+
+	outputs := make([]chan HyperionResponse, 0)
+	c.mux.Lock()
+	for _, s := range c.subscriptions() {
+		if s.closed {
+			continue
+		}
+		s.rollback(f.StartingBlock)
+		if !hasChan(outputs, s.results) {
+			outputs = append(outputs, s.results)
+		}
+	}
+	c.mux.Unlock()
+	if len(outputs) == 0 {
+		outputs = append(outputs, c.results)
+	}
+
+	for _, out := range outputs {
+		if out == nil {
+			continue
+		}
+		select {
+		case out <- f:
+		case <-c.Ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// rollback rewinds the subscription to before a forked block, and forgets recently delivered traces since the
+// replacement blocks may reuse their identities.
+func (s *Subscription) rollback(start uint32) {
+	if s.block >= start {
+		s.block = start - 1
+		s.keys = make(map[string]bool)
+	}
+	s.recent = nil
+	s.recentRing = nil
+	s.recentPos = 0
+}
+
+// Type satisfies the HyperionResponse interface and will return what type of response this is.
+func (f *ForkEvent) Type() ResponseType {
+	return RespForkType
+}
+
+// Mode satisfies the HyperionResponse interface, forks are only reported for live data.
+func (f *ForkEvent) Mode() ResponseMode {
+	return RespModeLive
+}
+
+// Envelope satisfies the HyperionResponse interface and will return the event fields the fork was sent with
+func (f *ForkEvent) Envelope() Envelope {
+	return f.envelope
+}
+
+// RawJSON satisfies the HyperionResponse interface and will return the body of the fork_event
+func (f *ForkEvent) RawJSON() json.RawMessage {
+	return f.Raw
+}
+
+// Action satisfies the HyperionResponse interface and will return an error since this is a fork
+func (f *ForkEvent) Action() (*ActionTrace, error) {
+	return nil, NotActionError{}
+}
+
+// Delta satisfies the HyperionResponse interface and will return an error since this is a fork
+func (f *ForkEvent) Delta() (*DeltaTrace, error) {
+	return nil, NotDeltaError{}
+}
+
+// Fork satisfies the HyperionResponse interface and will return the stream.ForkEvent
+func (f *ForkEvent) Fork() (*ForkEvent, error) {
+	return f, nil
+}
+
+// ToJson marshals a ForkEvent to JSON
+func (f *ForkEvent) ToJson() []byte {
+	if f == nil {
+		return nil
+	}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeFork(t *testing.T) {
+	for _, m := range []string{
+		`42["fork_event",{"chain_id":"abc","data":{"starting_block":100,"ending_block":102,"new_id":"0a"}}]`,
+		`42["fork_event",{"chain_id":"abc","starting_block":"100","ending_block":"102","new_id":"0a"}]`,
+	} {
+		raw, ok := getRaw([]byte(m), &Client{})
+		if !ok {
+			t.Fatal("fork event was discarded")
+		}
+		responses, err := decodeResult(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(responses) != 1 || responses[0].Type() != RespForkType {
+			t.Fatalf("expected a fork, got %+v", responses)
+		}
+		f, err := responses[0].Fork()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.ChainId != "abc" || f.StartingBlock != 100 || f.EndingBlock != 102 || f.NewId != "0a" {
+			t.Errorf("incorrect fork %+v", f)
+		}
+		if _, err = f.Action(); err == nil {
+			t.Error("fork cannot convert to action")
+		}
+		if _, err = f.Delta(); err == nil {
+			t.Error("fork cannot convert to delta")
+		}
+		if len(f.ToJson()) == 0 {
+			t.Error("got empty json")
+		}
+		var body interface{}
+		if err = json.Unmarshal(f.RawJSON(), &body); err != nil || !reflect.DeepEqual(body, raw[1]) {
+			t.Errorf("expected the event body, got %s", f.RawJSON())
+		}
+	}
+}
+
+func TestForkDelivery(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithOrderedDelivery(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, actionFrame(t, 100, 1))
+	nextResult(t, results)
+	fc.send(t, `42["fork_event",{"chain_id":"abc","data":{"starting_block":100,"ending_block":100,"new_id":"0a"}}]`)
+	if r := nextResult(t, results); r.Type() != RespForkType {
+		t.Fatalf("expected fork, got %v", r.Type())
+	}
+	// the replacement block reuses the global sequence, and must not be treated as a duplicate:
+	fc.send(t, actionFrame(t, 100, 1))
+	if r := nextResult(t, results); r.Type() != RespActionType {
+		t.Fatalf("expected replacement action, got %v", r.Type())
+	}
+}
+
+func TestForkUnreadResults(t *testing.T) {
+	f := newFakeHyperion(t)
+	// the Client's results channel is never read:
+	c, err := NewClient(f.url(), make(chan HyperionResponse), make(chan error, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	own := make(chan HyperionResponse)
+	if _, err = c.SubscribeActions(context.Background(), NewActionsReq("eosio.token", "", "transfer"), own); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, actionFrame(t, 100, 1))
+	nextResult(t, own)
+	fc.send(t, `42["fork_event",{"chain_id":"abc","data":{"starting_block":100,"ending_block":100,"new_id":"0a"}}]`)
+	if r := nextResult(t, own); r.Type() != RespForkType {
+		t.Fatalf("expected fork, got %v", r.Type())
+	}
+	fc.send(t, actionFrame(t, 100, 1))
+	if r := nextResult(t, own); r.Type() != RespActionType {
+		t.Fatalf("expected replacement action, got %v", r.Type())
+	}
+}
+
+func TestForkIrreversible(t *testing.T) {
+	c := &Client{irreversible: &irreversibleBuffer{limit: 10}}
+	for _, block := range []uint32{8, 9, 10, 11} {
+		c.hold(&DeltaTrace{BlockNum: block})
+	}
+	c.rollback(&ForkEvent{StartingBlock: 10, EndingBlock: 11})
+	if len(c.irreversible.traces) != 2 || blockNum(c.irreversible.traces[1]) != 9 {
+		t.Errorf("orphaned traces were not discarded: %+v", c.irreversible.traces)
+	}
+}
+
+func TestNotForkError(t *testing.T) {
+	if (NotForkError{}).Error() == "" {
+		t.Error("err is empty")
+	}
+	if _, err := (&ActionTrace{}).Fork(); err == nil {
+		t.Error("action cannot convert to fork")
+	}
+	if _, err := (&DeltaTrace{}).Fork(); err == nil {
+		t.Error("delta cannot convert to fork")
+	}
+}
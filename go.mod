@@ -1,8 +1,19 @@
 module github.com/blockpane/go-hyperion-stream
 
-go 1.15
+go 1.21
 
 require (
 	github.com/eoscanada/eos-go v0.9.0
-	nhooyr.io/websocket v1.8.6
+	nhooyr.io/websocket v1.8.17
+)
+
+require (
+	github.com/tidwall/gjson v1.3.2 // indirect
+	github.com/tidwall/match v1.0.1 // indirect
+	github.com/tidwall/pretty v1.0.0 // indirect
+	github.com/tidwall/sjson v1.0.4 // indirect
+	go.uber.org/atomic v1.4.0 // indirect
+	go.uber.org/multierr v1.2.0 // indirect
+	go.uber.org/zap v1.10.0 // indirect
+	golang.org/x/crypto v0.0.0-20191002192127-34f69633bfdc // indirect
 )
@@ -0,0 +1,234 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"nhooyr.io/websocket"
+	"sync/atomic"
+	"time"
+)
+
+// Engine.IO defaults, which are used until the server's open packet is received.
+const (
+	defaultPingInterval = 25 * time.Second
+	defaultPingTimeout  = 20 * time.Second
+)
+
+// openPacket is the Engine.IO handshake sent by the server once the websocket is opened, intervals are in
+// milliseconds.
+type openPacket struct {
+	Sid          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int64    `json:"pingInterval"`
+	PingTimeout  int64    `json:"pingTimeout"`
+}
+
+// parseOpen decodes an open packet, which is "0" followed by a JSON object.
+func parseOpen(m []byte) (open openPacket, err error) {
+	if len(m) < 2 || m[0] != '0' {
+		return open, fmt.Errorf("invalid open packet: %q", m)
+	}
+	err = json.Unmarshal(m[1:], &open)
+	return open, err
+}
+
+// SessionID is the Engine.IO session id assigned by the server for the current websocket, it changes after a
+// reconnect and is empty until the handshake has been received.
+func (c *Client) SessionID() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.sid
+}
+
+// heartbeat keeps a single websocket alive. With Engine.IO v3 the client sends pings and the server replies with
+// pongs, with v4 the server sends the pings instead and the client replies.
+type heartbeat struct {
+	eio       int
+	idle      time.Duration
+	lastEvent atomic.Int64
+	open      chan openPacket
+	ping      chan struct{}
+	pong      chan struct{}
+	dead      chan error
+}
+
+func newHeartbeat(eio int, idle time.Duration) *heartbeat {
+	h := &heartbeat{
+		eio:  eio,
+		idle: idle,
+		open: make(chan openPacket, 1),
+		ping: make(chan struct{}, 1),
+		pong: make(chan struct{}, 1),
+		dead: make(chan error, 1),
+	}
+	h.lastEvent.Store(time.Now().UnixNano())
+	return h
+}
+
+// opened handles the open packet, storing the session id and passing the intervals on to the heartbeat.
+func (h *heartbeat) opened(c *Client, m []byte) {
+	open, err := parseOpen(m)
+	if err != nil {
+		c.report(err)
+		return
+	}
+	c.mux.Lock()
+	c.sid = open.Sid
+	c.mux.Unlock()
+	select {
+	case h.open <- open:
+	default:
+	}
+}
+
+// pinged records a ping from the server.
+func (h *heartbeat) pinged() {
+	select {
+	case h.ping <- struct{}{}:
+	default:
+	}
+}
+
+// received records that an event was received, for the idle timeout.
+func (h *heartbeat) received() {
+	if h.idle > 0 {
+		h.lastEvent.Store(time.Now().UnixNano())
+	}
+}
+
+// ponged records a pong from the server.
+func (h *heartbeat) ponged() {
+	select {
+	case h.pong <- struct{}{}:
+	default:
+	}
+}
+
+// run handles pings until ctx is cancelled. If the server stops replying within the ping timeout, or with v4 stops
+// sending pings within the ping interval plus timeout, the websocket is declared dead: a PongTimeoutError is queued
+// for serve to return and cancel is called to interrupt its read. The same happens with an IdleTimeoutError if
+// using WithIdleTimeout and no events are received in time, or with a StalledError if using WithStallDetection.
+func (h *heartbeat) run(ctx context.Context, cancel func(), c *Client, conn *websocket.Conn) {
+	interval, timeout := defaultPingInterval, defaultPingTimeout
+
+	var pings <-chan time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	if h.eio == 3 {
+		pings = ticker.C
+	} else {
+		ticker.Stop()
+	}
+
+	var expired <-chan time.Time
+	watchdog := time.NewTimer(interval + timeout)
+	defer watchdog.Stop()
+	if h.eio == 3 {
+		watchdog.Stop()
+	} else {
+		expired = watchdog.C
+	}
+	var stall <-chan time.Time
+	var stallReported bool
+	opened := time.Now()
+	if c.stallAfter > 0 {
+		// the lag of a previous connection doesn't apply to this one:
+		c.progress.lag.Store(0)
+		stallCheck := time.NewTicker(c.stallAfter/4 + time.Millisecond)
+		defer stallCheck.Stop()
+		stall = stallCheck.C
+	}
+
+	var idle <-chan time.Time
+	if h.idle > 0 {
+		idleCheck := time.NewTicker(h.idle/4 + time.Millisecond)
+		defer idleCheck.Stop()
+		idle = idleCheck.C
+	}
+
+	expect := func(d time.Duration) {
+		if !watchdog.Stop() {
+			select {
+			case <-watchdog.C:
+			default:
+			}
+		}
+		watchdog.Reset(d)
+		expired = watchdog.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case open := <-h.open:
+			if open.PingInterval > 0 {
+				interval = time.Duration(open.PingInterval) * time.Millisecond
+			}
+			if open.PingTimeout > 0 {
+				timeout = time.Duration(open.PingTimeout) * time.Millisecond
+			}
+			if h.eio == 3 {
+				ticker.Reset(interval)
+			} else {
+				expect(interval + timeout)
+			}
+		case <-pings:
+			err := conn.Write(ctx, websocket.MessageText, []byte("2"))
+			if err != nil {
+				c.report(err)
+			}
+			if expired == nil {
+				expect(timeout)
+			}
+		case <-h.pong:
+			watchdog.Stop()
+			expired = nil
+		case <-h.ping:
+			err := conn.Write(ctx, websocket.MessageText, []byte("3"))
+			if err != nil {
+				c.report(err)
+			}
+			expect(interval + timeout)
+		case <-stall:
+			err := c.stalled(opened)
+			switch {
+			case err != nil && c.stallReconnect:
+				h.dead <- err
+				cancel()
+				return
+			case err != nil && !stallReported:
+				c.goroutine(func() {
+					c.report(err)
+				})
+			}
+			stallReported = err != nil
+		case <-idle:
+			if time.Since(time.Unix(0, h.lastEvent.Load())) >= h.idle {
+				h.dead <- IdleTimeoutError{Endpoint: c.ActiveEndpoint(), Timeout: h.idle}
+				cancel()
+				return
+			}
+		case <-expired:
+			if h.eio == 3 {
+				h.dead <- PongTimeoutError{Timeout: timeout}
+			} else {
+				h.dead <- PongTimeoutError{Timeout: interval + timeout}
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// PongTimeoutError is returned when the server stopped replying to pings, or with Engine.IO v4 stopped sending them,
+// and the websocket was considered dead.
+type PongTimeoutError struct {
+	Timeout time.Duration
+}
+
+// Error satisfies the error interface
+func (p PongTimeoutError) Error() string {
+	return fmt.Sprintf("no pong received within %s, the connection is dead", p.Timeout)
+}
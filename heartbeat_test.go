@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseOpen(t *testing.T) {
+	open, err := parseOpen([]byte(`0{"sid":"abc","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.Sid != "abc" || open.PingInterval != 25000 || open.PingTimeout != 5000 {
+		t.Errorf("unexpected open packet: %+v", open)
+	}
+	for _, m := range []string{"", "0", "40", `0{"sid":`} {
+		if _, err = parseOpen([]byte(m)); err == nil {
+			t.Errorf("expected an error parsing %q", m)
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.open = `0{"sid":"session-1","upgrades":[],"pingInterval":50,"pingTimeout":1000}`
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	// pings are answered by the fake server, so the connection should stay up well past the ping timeout:
+	time.Sleep(1500 * time.Millisecond)
+	if c.Ctx.Err() != nil {
+		t.Fatal("connection closed while pongs were being received")
+	}
+	if c.SessionID() != "session-1" {
+		t.Errorf("expected session id from the handshake, got %q", c.SessionID())
+	}
+	if pings := atomic.LoadInt32(&fc.pings); pings < 10 {
+		t.Errorf("expected pings at the server's interval, got %d", pings)
+	}
+	select {
+	case err = <-errs:
+		t.Error("unexpected error:", err)
+	default:
+	}
+}
+
+func TestPongTimeout(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.open = `0{"sid":"session-1","upgrades":[],"pingInterval":50,"pingTimeout":100}`
+	f.noPong = true
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	fc.expect(t, "2")
+
+	select {
+	case err = <-errs:
+		var timeout PongTimeoutError
+		if !errors.As(err, &timeout) {
+			t.Fatalf("expected a PongTimeoutError, got %v", err)
+		}
+		if timeout.Timeout != 100*time.Millisecond {
+			t.Errorf("expected the server's ping timeout, got %s", timeout.Timeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pong timeout")
+	}
+	select {
+	case <-c.Ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client was not shut down")
+	}
+}
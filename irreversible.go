@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// defaultIrreversibleLimit is the number of traces held by WithIrreversibleOnly when no limit is supplied.
+const defaultIrreversibleLimit = 100000
+
+// WithIrreversibleOnly holds each trace until Client.LibNum has reached its block, so only irreversible data is sent
+// over the results channels. At most limit traces are held, once full any further traces are discarded and a
+// BufferOverflowError is sent over the errors channel. A limit less than one uses a default of 100,000 traces.
+//
+// Traces are released in the order they were received, so this is best combined with WithOrderedDelivery.
+func WithIrreversibleOnly(limit int) Option {
+	return func(c *Client) {
+		if limit < 1 {
+			limit = defaultIrreversibleLimit
+		}
+		c.irreversible = &irreversibleBuffer{limit: limit}
+	}
+}
+
+// irreversibleBuffer holds traces, in the order they were received, until their block is irreversible.
+type irreversibleBuffer struct {
+	limit  int
+	traces []HyperionResponse
+}
+
+// blockNum returns the block a trace was included in.
+func blockNum(resp HyperionResponse) uint32 {
+	switch r := resp.(type) {
+	case *ActionTrace:
+		return r.BlockNum
+	case *DeltaTrace:
+		return r.BlockNum
+	}
+	return 0
+}
+
+// hold buffers a trace until it is irreversible, returning true if it is already irreversible and can be delivered.
+// Traces are also held if earlier ones are still waiting, so they are not released out of order.
+func (c *Client) hold(resp HyperionResponse) bool {
+	b := c.irreversible
+	lib := atomic.LoadUint32(&c.LibNum)
+	if len(b.traces) == 0 && blockNum(resp) <= lib {
+		return true
+	}
+	if len(b.traces) >= b.limit {
+		c.report(BufferOverflowError{Limit: b.limit, BlockNum: blockNum(resp), LibNum: lib})
+		return false
+	}
+	b.traces = append(b.traces, resp)
+	return false
+}
+
+// release delivers held traces that have become irreversible. It returns false if the Client was cancelled.
+func (c *Client) release() bool {
+	b := c.irreversible
+	if b == nil {
+		return true
+	}
+	lib := atomic.LoadUint32(&c.LibNum)
+	for len(b.traces) > 0 && blockNum(b.traces[0]) <= lib {
+		resp := b.traces[0]
+		b.traces[0] = nil
+		b.traces = b.traces[1:]
+		if !c.deliver(resp) {
+			return false
+		}
+	}
+	return true
+}
+
+// BufferOverflowError is sent over the errors channel when WithIrreversibleOnly is holding its limit of traces, the
+// trace for BlockNum was discarded.
+type BufferOverflowError struct {
+	Limit    int
+	BlockNum uint32
+	LibNum   uint32
+}
+
+// Error satisfies the error interface
+func (b BufferOverflowError) Error() string {
+	return fmt.Sprintf("irreversible buffer is full with %d traces at lib %d, discarded trace for block %d", b.Limit, b.LibNum, b.BlockNum)
+}
@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIrreversibleOnly(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithOrderedDelivery(4), WithIrreversibleOnly(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, libFrame(9))
+	fc.send(t, actionFrame(t, 9, 1))
+	if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != 1 {
+		t.Fatal("irreversible trace should be delivered immediately")
+	}
+
+	fc.send(t, actionFrame(t, 10, 2))
+	fc.send(t, actionFrame(t, 11, 3))
+	fc.send(t, actionFrame(t, 12, 4))
+	var overflow error
+	select {
+	case overflow = <-errs:
+	case <-time.After(5 * time.Second):
+	}
+	if !errors.As(overflow, &BufferOverflowError{}) {
+		t.Fatalf("expected BufferOverflowError, got %v", overflow)
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("reversible trace was delivered: %+v", r)
+	default:
+	}
+
+	fc.send(t, libFrame(10))
+	if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != 2 {
+		t.Fatal("expected block 10 to be released")
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("reversible trace was delivered: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fc.send(t, libFrame(20))
+	if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != 3 {
+		t.Fatal("expected block 11 to be released")
+	}
+}
+
+func TestBufferOverflowError(t *testing.T) {
+	if (BufferOverflowError{}).Error() == "" {
+		t.Error("err is empty")
+	}
+}
@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"nhooyr.io/websocket"
+)
+
+// WithReadLimit sets the size in bytes of the largest message accepted from Hyperion, the default is 32768. Action
+// traces with large data payloads may need more. A larger message closes the websocket unless WithSkipOversize is
+// also used.
+func WithReadLimit(n int64) Option {
+	return func(c *Client) {
+		c.readLimit = n
+	}
+}
+
+// WithSkipOversize discards messages larger than the read limit instead of closing the websocket, each is reported
+// over the errors channel as an OversizeMessageError.
+func WithSkipOversize() Option {
+	return func(c *Client) {
+		c.skipOversize = true
+	}
+}
+
+// read returns the next message from the websocket. When skipping oversized messages the websocket's own limit is
+// disabled and enforced here instead, and a nil message is returned for each one that was discarded.
+func (c *Client) read(ctx context.Context, conn *websocket.Conn) (websocket.MessageType, []byte, error) {
+	if !c.skipOversize {
+		return conn.Read(ctx)
+	}
+	mtype, r, err := conn.Reader(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	message, err := io.ReadAll(io.LimitReader(r, c.readLimit+1))
+	if err != nil {
+		return 0, nil, err
+	}
+	if int64(len(message)) <= c.readLimit {
+		return mtype, message, nil
+	}
+
+	rest, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.report(OversizeMessageError{Size: int64(len(message)) + rest, Limit: c.readLimit})
+	return mtype, nil, nil
+}
+
+// OversizeMessageError is sent over the errors channel when using WithSkipOversize and a message larger than the read
+// limit was discarded.
+type OversizeMessageError struct {
+	Size  int64
+	Limit int64
+}
+
+// Error satisfies the error interface
+func (o OversizeMessageError) Error() string {
+	return fmt.Sprintf("discarded a %d byte message exceeding the read limit of %d bytes", o.Size, o.Limit)
+}
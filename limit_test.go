@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bigActionFrame is an action trace with a memo large enough to exceed the default read limit.
+func bigActionFrame(t *testing.T, block uint32, seq uint64) string {
+	t.Helper()
+	a := &ActionTrace{BlockNum: block, GlobalSequence: seq}
+	a.Act.Account = "eosio.token"
+	a.Act.Name = "transfer"
+	a.Act.Data = map[string]interface{}{"memo": strings.Repeat("x", 2*maxMessageSize)}
+	return traceFrame(t, "action_trace", RespModeLive, a)
+}
+
+func TestReadLimit(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithReadLimit(4*maxMessageSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, bigActionFrame(t, 1, 1))
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memo, _ := a.Act.Data["memo"].(string); len(memo) != 2*maxMessageSize {
+		t.Errorf("expected a %d byte memo, got %d", 2*maxMessageSize, len(memo))
+	}
+}
+
+func TestReadLimitExceeded(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	fc.send(t, bigActionFrame(t, 1, 1))
+	select {
+	case <-c.Ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("an oversized message should close the websocket")
+	}
+}
+
+func TestSkipOversize(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithSkipOversize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	big := bigActionFrame(t, 1, 1)
+	fc.send(t, big)
+	fc.send(t, actionFrame(t, 1, 2))
+	select {
+	case err = <-errs:
+		var oversize OversizeMessageError
+		if !errors.As(err, &oversize) {
+			t.Fatalf("expected an OversizeMessageError, got %v", err)
+		}
+		if oversize.Size != int64(len(big)) || oversize.Limit != maxMessageSize {
+			t.Errorf("unexpected size or limit: %+v", oversize)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an OversizeMessageError")
+	}
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GlobalSequence != 2 {
+		t.Errorf("expected the next trace after the oversized one, got %d", a.GlobalSequence)
+	}
+}
@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"runtime"
+)
+
+// WithOrderedDelivery guarantees that traces are delivered in the order Hyperion sent them, which is by global
+// sequence for actions and by block for deltas. Messages are still decoded in parallel by a pool of workers, and are
+// then reassembled in order before delivery. lib_update events are applied once the traces sent before them have been
+// delivered, so Client.LibNum is never updated ahead of them. A workers value less than one will use one worker per
+// CPU.
+//
+// Without this option each message is decoded and delivered on its own goroutine, and may arrive out of order.
+func WithOrderedDelivery(workers int) Option {
+	return func(c *Client) {
+		if workers < 1 {
+			workers = runtime.NumCPU()
+		}
+		c.ordered = &orderedPipeline{
+			workers: workers,
+			frames:  make(chan frame, workers*2),
+			decoded: make(chan frame, workers*2),
+		}
+	}
+}
+
+// frame is a single socket.io event, numbered in the order it was read from the websocket.
+type frame struct {
+	seq     uint64
+	message []byte
+
+	raw       []interface{}
+	responses []HyperionResponse
+	err       error
+}
+
+// orderedPipeline decodes frames on a bounded pool of workers, and reassembles the results in sequence.
+type orderedPipeline struct {
+	workers int
+	next    uint64
+	frames  chan frame
+	decoded chan frame
+}
+
+// start launches the workers and the reassembly stage, all of which exit when the Client is cancelled.
+func (p *orderedPipeline) start(c *Client) {
+	for i := 0; i < p.workers; i++ {
+		c.goroutine(func() {
+			p.decode(c)
+		})
+	}
+	c.goroutine(func() {
+		p.reassemble(c)
+	})
+}
+
+// dispatch numbers a message and queues it for decoding, it blocks the websocket reader once all workers are busy.
+func (p *orderedPipeline) dispatch(c *Client, message []byte) {
+	select {
+	case p.frames <- frame{seq: p.next, message: message}:
+		p.next++
+	case <-c.Ctx.Done():
+	}
+}
+
+// decode parses frames into traces, or lib updates.
+func (p *orderedPipeline) decode(c *Client) {
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case f := <-p.frames:
+			f.raw, f.err = parseRaw(f.message)
+			if f.err == nil && f.raw != nil && (f.raw[0] == "message" || f.raw[0] == "fork_event") {
+				f.responses, f.err = decodeResult(f.raw)
+			}
+			if f.err == nil && c.abis != nil {
+				c.normalize(f.responses)
+			}
+			f.message = nil
+			select {
+			case p.decoded <- f:
+			case <-c.Ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// reassemble holds decoded frames until every frame before them has been handled, and then forwards traces and lib
+// updates to route in their original order.
+func (p *orderedPipeline) reassemble(c *Client) {
+	var want uint64
+	pending := make(map[uint64]frame)
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case f := <-p.decoded:
+			pending[f.seq] = f
+		}
+		for {
+			f, ok := pending[want]
+			if !ok {
+				break
+			}
+			delete(pending, want)
+			want++
+
+			switch {
+			case f.err != nil:
+				c.report(f.err)
+			case f.raw == nil:
+				continue
+			case f.raw[0] == "lib_update":
+				f.responses = []HyperionResponse{&libUpdate{raw: f.raw}}
+			}
+			for _, resp := range f.responses {
+				select {
+				case c.incoming <- resp:
+				case <-c.Ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// libUpdate carries a lib_update event from the ordered pipeline through route, so it is applied after the traces
+// that came before it are delivered. It is never delivered itself.
+type libUpdate struct {
+	HyperionResponse
+	raw []interface{}
+}
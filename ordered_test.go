@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOrderedDelivery(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errors, WithOrderedDelivery(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	fc.expectRequest(t, "action_stream_request")
+
+	const count = 500
+	go func() {
+		for i := uint64(1); i <= count; i++ {
+			fc.send(t, actionFrame(t, uint32(i/10)+1, i))
+			if i == count/2 {
+				fc.send(t, libFrame(uint32(i/10)+1))
+			}
+		}
+	}()
+	for i := uint64(1); i <= count; i++ {
+		// the update may be applied as soon as the trace before it is received, so check before each receive, and give
+		// an early update time to land before the last one:
+		if i == count/2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if i <= count/2 && atomic.LoadUint32(&c.LibNum) != 0 {
+			t.Fatal("lib update was applied ahead of earlier traces")
+		}
+		a, err := nextResult(t, results).Action()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.GlobalSequence != i {
+			t.Fatalf("expected global sequence %d, got %d", i, a.GlobalSequence)
+		}
+	}
+	if lib := atomic.LoadUint32(&c.LibNum); lib != count/20+1 {
+		t.Errorf("expected lib %d, got %d", count/20+1, lib)
+	}
+}
@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"encoding/json"
+)
+
+// Protocol selects the Engine.IO protocol revision used to talk to Hyperion. Hyperion v3.3 runs socket.io v2 which
+// speaks Engine.IO v3, newer deployments run socket.io v4 which speaks Engine.IO v4.
+type Protocol uint8
+
+const (
+	// ProtocolAuto tries Engine.IO v3 first and falls back to v4 if the server rejects the version. Servers that
+	// accept both will be spoken to using v3.
+	ProtocolAuto Protocol = iota
+	// ProtocolEIO3 only uses Engine.IO v3, where the client sends pings.
+	ProtocolEIO3
+	// ProtocolEIO4 only uses Engine.IO v4, where the server sends pings and the client must connect to the
+	// namespace.
+	ProtocolEIO4
+)
+
+// WithProtocol sets the Engine.IO protocol revision, the default is ProtocolAuto.
+func WithProtocol(p Protocol) Option {
+	return func(c *Client) {
+		c.protocol = p
+	}
+}
+
+// versions lists the Engine.IO versions to try dialing, in order.
+func (p Protocol) versions() []int {
+	switch p {
+	case ProtocolEIO3:
+		return []int{3}
+	case ProtocolEIO4:
+		return []int{4}
+	}
+	return []int{3, 4}
+}
+
+// ConnectError is returned when Hyperion refuses to connect to the socket.io namespace, either while dialing or
+// later over the errors channel. Message is as sent by Hyperion.
+type ConnectError struct {
+	Message string
+}
+
+// Error satisfies the error interface
+func (ce ConnectError) Error() string {
+	return "socket.io connection refused: " + ce.Message
+}
+
+// parseConnectError decodes a socket.io connect error packet, which is "44" followed by an optional JSON payload.
+func parseConnectError(m []byte) ConnectError {
+	body := m[2:]
+	var reason struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &reason) == nil && reason.Message != "" {
+		return ConnectError{Message: reason.Message}
+	}
+	var msg string
+	if json.Unmarshal(body, &msg) == nil {
+		return ConnectError{Message: msg}
+	}
+	return ConnectError{Message: string(body)}
+}
@@ -0,0 +1,172 @@
+package stream
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"nhooyr.io/websocket"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProtocolAuto(t *testing.T) {
+	for _, eio := range []string{"3", "4"} {
+		t.Run("EIO"+eio, func(t *testing.T) {
+			f := newFakeHyperion(t)
+			f.versions = []string{eio}
+			f.pingEvery = 50 * time.Millisecond
+			f.open = `0{"sid":"fake","upgrades":[],"pingInterval":50,"pingTimeout":200}`
+			results := make(chan HyperionResponse)
+			errs := make(chan error, 16)
+			c, err := NewClient(f.url(), results, errs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			fc := f.accept(t)
+			if fc.eio != eio {
+				t.Fatalf("expected Engine.IO %s, got %s", eio, fc.eio)
+			}
+
+			if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+				t.Fatal(err)
+			}
+			fc.send(t, actionFrame(t, 1, 1))
+			if _, err = nextResult(t, results).Action(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the heartbeat must keep the connection alive for several ping timeouts:
+			time.Sleep(time.Second)
+			select {
+			case err = <-errs:
+				t.Fatal("unexpected error:", err)
+			default:
+			}
+			if c.Ctx.Err() != nil {
+				t.Fatal("connection was closed")
+			}
+			if early := atomic.LoadInt32(&fc.early); early != 0 {
+				t.Errorf("%d event(s) were sent before connecting to the namespace", early)
+			}
+			pings, pongs := atomic.LoadInt32(&fc.pings), atomic.LoadInt32(&fc.pongs)
+			switch {
+			case eio == "3" && (pings == 0 || pongs != 0):
+				t.Errorf("Engine.IO v3 clients send pings, got %d pings and %d pongs", pings, pongs)
+			case eio == "4" && (pings != 0 || pongs == 0):
+				t.Errorf("Engine.IO v4 clients answer pings, got %d pings and %d pongs", pings, pongs)
+			}
+		})
+	}
+}
+
+func TestProtocolExplicit(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.versions = []string{"3", "4"}
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithProtocol(ProtocolEIO4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if fc := f.accept(t); fc.eio != "4" {
+		t.Errorf("expected Engine.IO 4, got %s", fc.eio)
+	}
+
+	f.versions = []string{"4"}
+	if _, err = NewClient(f.url(), results, errs, WithProtocol(ProtocolEIO3)); err == nil {
+		t.Error("expected Engine.IO 3 to be rejected")
+	}
+}
+
+func TestProtocolEIO4PingTimeout(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.versions = []string{"4"}
+	f.open = `0{"sid":"fake","upgrades":[],"pingInterval":50,"pingTimeout":50}`
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	f.accept(t)
+
+	select {
+	case err = <-errs:
+		var timeout PongTimeoutError
+		if !errors.As(err, &timeout) {
+			t.Fatalf("expected a PongTimeoutError, got %v", err)
+		}
+		if timeout.Timeout != 100*time.Millisecond {
+			t.Errorf("expected the ping interval plus timeout, got %s", timeout.Timeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the server's pings to be missed")
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.versions = []string{"4"}
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	fc.send(t, `44{"message":"Not authorized"}`)
+
+	select {
+	case err = <-errs:
+		if !errors.Is(err, ConnectError{Message: "Not authorized"}) {
+			t.Fatalf("expected a ConnectError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connect error")
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	open := `0{"sid":"fake","upgrades":[],"pingInterval":25000,"pingTimeout":20000}`
+	// an Engine.IO v4 server that refuses the namespace connect:
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("EIO") != "4" {
+			http.Error(w, `{"code":5,"message":"Unsupported protocol version"}`, http.StatusBadRequest)
+			return
+		}
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.CloseNow()
+		_ = ws.Write(r.Context(), websocket.MessageText, []byte(open))
+		if _, m, err := ws.Read(r.Context()); err == nil && string(m) == "40" {
+			_ = ws.Write(r.Context(), websocket.MessageText, []byte(`44{"message":"Not authorized"}`))
+		}
+		_, _, _ = ws.Read(r.Context())
+	}))
+	defer srv.Close()
+
+	_, err := NewClient("ws"+strings.TrimPrefix(srv.URL, "http"), make(chan HyperionResponse), make(chan error, 16))
+	if !errors.Is(err, ConnectError{Message: "Not authorized"}) {
+		t.Fatalf("expected a ConnectError, got %v", err)
+	}
+}
+
+func TestParseConnectError(t *testing.T) {
+	for m, want := range map[string]string{
+		`44{"message":"Not authorized"}`: "Not authorized",
+		`44"Invalid namespace"`:          "Invalid namespace",
+		`44`:                             "",
+	} {
+		if got := parseConnectError([]byte(m)); got.Message != want {
+			t.Errorf("%s: expected %q, got %q", m, want, got.Message)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultQuorumTimeout is how long a QuorumClient waits for providers to agree on a trace.
+const defaultQuorumTimeout = 30 * time.Second
+
+// minQuorumSweep is the shortest interval between checks for ballots that have timed out.
+const minQuorumSweep = 10 * time.Millisecond
+
+// Quorum configures a QuorumClient. Size is how many Endpoints must report an identical trace before it is
+// delivered, it defaults to a majority. Timeout is how long to wait for the remaining providers after the first one
+// reports a trace, it defaults to 30 seconds and must not be negative.
+type Quorum struct {
+	Endpoints []string
+	Size      int
+	Timeout   time.Duration
+}
+
+// QuorumClient streams the same actions from several Hyperion providers, and only delivers a trace once a quorum of
+// them has reported an identical copy. Traces are matched by TrxId and GlobalSequence. When providers disagree, or a
+// trace never reaches quorum, a QuorumError is sent over the errors channel. Like a Client's, errors are buffered so
+// a slow consumer never stalls delivery, and any that don't fit are dropped and counted in Stats.ErrorsDropped. The
+// QuorumClient.Ctx is closed once fewer than a quorum of providers remain connected.
+type QuorumClient struct {
+	Ctx context.Context
+
+	quorum  Quorum
+	clients []*Client
+	cancel  func()
+	results chan HyperionResponse
+	errors  chan error
+	votes   chan vote
+	lost    chan int
+	wg      sync.WaitGroup
+
+	errorQueue    chan error
+	errorsDropped atomic.Uint64
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// vote is a trace reported by a single provider.
+type vote struct {
+	provider int
+	resp     HyperionResponse
+}
+
+// ballot collects the votes for one trace.
+type ballot struct {
+	first     time.Time
+	decided   bool
+	votes     map[int][]byte
+	responses map[int]HyperionResponse
+}
+
+// NewQuorumClient connects to each of the quorum's endpoints, the opts are applied to every underlying Client. It
+// fails if fewer than a quorum of the endpoints can be dialed, endpoints that fail are not retried.
+func NewQuorumClient(ctx context.Context, quorum Quorum, results chan HyperionResponse, errors chan error, opts ...Option) (*QuorumClient, error) {
+	if quorum.Size == 0 {
+		quorum.Size = len(quorum.Endpoints)/2 + 1
+	}
+	if quorum.Size < 1 || quorum.Size > len(quorum.Endpoints) {
+		return nil, fmt.Errorf("invalid quorum of %d for %d endpoint(s)", quorum.Size, len(quorum.Endpoints))
+	}
+	if quorum.Timeout < 0 {
+		return nil, fmt.Errorf("invalid quorum timeout of %s", quorum.Timeout)
+	}
+	if quorum.Timeout == 0 {
+		quorum.Timeout = defaultQuorumTimeout
+	}
+
+	q := &QuorumClient{
+		quorum:  quorum,
+		results: results,
+		errors:  errors,
+		votes:   make(chan vote),
+		lost:    make(chan int, len(quorum.Endpoints)),
+		closing: make(chan struct{}),
+
+		errorQueue: make(chan error, defaultErrorBuffer),
+	}
+	q.Ctx, q.cancel = context.WithCancel(ctx)
+	if errors != nil {
+		q.goroutine(func() {
+			forwardErrors(q.Ctx, q.errorQueue, q.errors, q.closing)
+		})
+	}
+
+	var dialErr error
+	for _, endpoint := range quorum.Endpoints {
+		provider := make(chan HyperionResponse)
+		providerErrors := make(chan error)
+		c, err := NewClientWithContext(q.Ctx, endpoint, provider, providerErrors, opts...)
+		if err != nil {
+			dialErr = EndpointError{Endpoint: endpoint, Err: err}
+			continue
+		}
+		index := len(q.clients)
+		q.clients = append(q.clients, c)
+		q.goroutine(func() {
+			q.forward(index, c, provider, providerErrors)
+		})
+	}
+	if len(q.clients) < quorum.Size {
+		_ = q.Close()
+		return nil, dialErr
+	}
+	q.goroutine(q.tally)
+	q.goroutine(q.watch)
+	return q, nil
+}
+
+// Endpoints returns the endpoints that were connected, in the order their votes are indexed.
+func (q *QuorumClient) Endpoints() []string {
+	endpoints := make([]string, len(q.clients))
+	for i, c := range q.clients {
+		endpoints[i] = c.ActiveEndpoint()
+	}
+	return endpoints
+}
+
+// Stats returns the number of errors that were dropped because the consumer fell behind.
+func (q *QuorumClient) Stats() Stats {
+	return Stats{ErrorsDropped: q.errorsDropped.Load()}
+}
+
+// SubscribeActions sends the request to every provider, it fails unless a quorum of them accept it. Rejections by
+// the remaining providers are sent over the errors channel.
+func (q *QuorumClient) SubscribeActions(ctx context.Context, req *ActionsReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	type result struct {
+		endpoint string
+		err      error
+	}
+	done := make(chan result, len(q.clients))
+	for _, c := range q.clients {
+		c := c
+		go func() {
+			_, err := c.SubscribeActions(ctx, req, nil)
+			done <- result{endpoint: c.ActiveEndpoint(), err: err}
+		}()
+	}
+
+	var accepted int
+	var failed []error
+	for range q.clients {
+		r := <-done
+		if r.err != nil {
+			failed = append(failed, EndpointError{Endpoint: r.endpoint, Err: r.err})
+			continue
+		}
+		accepted++
+	}
+	if accepted < q.quorum.Size {
+		return failed[len(failed)-1]
+	}
+	for _, err := range failed {
+		q.report(err)
+	}
+	return nil
+}
+
+// Close stops every underlying Client, and waits for them to exit.
+func (q *QuorumClient) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+		for _, c := range q.clients {
+			if err := c.Close(); err != nil && q.closeErr == nil {
+				q.closeErr = err
+			}
+		}
+		q.cancel()
+	})
+	q.wg.Wait()
+	return q.closeErr
+}
+
+func (q *QuorumClient) goroutine(fn func()) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		fn()
+	}()
+}
+
+// report buffers an error for the consumer without blocking, the same way a Client does.
+func (q *QuorumClient) report(err error) {
+	if q.errors != nil {
+		queueError(q.errorQueue, &q.errorsDropped, err, q.closing)
+	}
+}
+
+// forward passes a provider's traces on to be tallied, and its errors on to the consumer. Once the provider's Client
+// has shut down it is reported as lost, and the remaining errors explaining why are still forwarded.
+func (q *QuorumClient) forward(provider int, c *Client, results chan HyperionResponse, errors chan error) {
+	for {
+		select {
+		case <-q.Ctx.Done():
+			return
+		case <-c.Ctx.Done():
+			q.lost <- provider
+			for {
+				select {
+				case <-q.Ctx.Done():
+					return
+				case err := <-errors:
+					q.report(EndpointError{Endpoint: c.ActiveEndpoint(), Err: err})
+				}
+			}
+		case resp := <-results:
+			select {
+			case q.votes <- vote{provider: provider, resp: resp}:
+			case <-q.Ctx.Done():
+				return
+			}
+		case err := <-errors:
+			q.report(EndpointError{Endpoint: c.ActiveEndpoint(), Err: err})
+		}
+	}
+}
+
+// watch closes the QuorumClient once too few providers remain to reach a quorum, or its context is cancelled, and
+// sends an ExitError unless Close was called.
+func (q *QuorumClient) watch() {
+	remaining := len(q.clients)
+	for remaining >= q.quorum.Size && q.Ctx.Err() == nil {
+		select {
+		case <-q.Ctx.Done():
+		case <-q.lost:
+			remaining--
+		}
+	}
+	q.cancel()
+	select {
+	case <-q.closing:
+	default:
+		q.report(ExitError{})
+	}
+}
+
+// tally counts votes, delivering each trace once a quorum of providers has reported an identical copy.
+func (q *QuorumClient) tally() {
+	ballots := make(map[string]*ballot)
+	// finished traces are remembered so copies replayed after a provider reconnects are not delivered again:
+	finished := make(map[string]bool)
+	finishedRing := make([]string, recentSize)
+	var finishedPos int
+	finish := func(key string, b *ballot) {
+		delete(ballots, key)
+		delete(finished, finishedRing[finishedPos])
+		finishedRing[finishedPos] = key
+		finishedPos = (finishedPos + 1) % recentSize
+		finished[key] = true
+		q.finish(b)
+	}
+
+	interval := q.quorum.Timeout / 2
+	if interval < minQuorumSweep {
+		interval = minQuorumSweep
+	}
+	sweep := time.NewTicker(interval)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-q.Ctx.Done():
+			return
+		case <-sweep.C:
+			for key, b := range ballots {
+				if time.Since(b.first) >= q.quorum.Timeout {
+					finish(key, b)
+				}
+			}
+		case v := <-q.votes:
+			key, ok := quorumKey(v.resp)
+			if !ok || finished[key] {
+				continue
+			}
+			b := ballots[key]
+			if b == nil {
+				b = &ballot{first: time.Now(), votes: make(map[int][]byte), responses: make(map[int]HyperionResponse)}
+				ballots[key] = b
+			}
+			if _, voted := b.votes[v.provider]; voted {
+				continue
+			}
+			payload, err := json.Marshal(v.resp)
+			if err != nil {
+				q.report(err)
+				continue
+			}
+			b.votes[v.provider] = payload
+			b.responses[v.provider] = v.resp
+
+			if !b.decided && agreeing(b, payload) >= q.quorum.Size {
+				b.decided = true
+				select {
+				case q.results <- v.resp:
+				case <-q.Ctx.Done():
+					return
+				}
+			}
+			if len(b.votes) == len(q.clients) {
+				finish(key, b)
+			}
+		}
+	}
+}
+
+// finish reports a ballot that is complete or has timed out if the providers disagreed, or if it never reached
+// quorum.
+func (q *QuorumClient) finish(b *ballot) {
+	fields := differingFields(b.votes)
+	if b.decided && len(fields) == 0 {
+		return
+	}
+
+	var resp HyperionResponse
+	for _, resp = range b.responses {
+		break
+	}
+	qe := QuorumError{Reached: b.decided, Votes: len(b.votes), Quorum: q.quorum.Size}
+	if a, err := resp.Action(); err == nil {
+		qe.TrxId, qe.GlobalSequence = a.TrxId.String(), a.GlobalSequence
+	}
+	for _, field := range fields {
+		diff := FieldDiff{Field: field, Values: make(map[string]string)}
+		for provider, payload := range b.votes {
+			diff.Values[q.clients[provider].ActiveEndpoint()] = fieldValue(payload, field)
+		}
+		qe.Fields = append(qe.Fields, diff)
+	}
+	q.report(qe)
+}
+
+// quorumKey identifies a trace across providers.
+func quorumKey(resp HyperionResponse) (string, bool) {
+	if a, err := resp.Action(); err == nil {
+		return a.TrxId.String() + ":" + strconv.FormatUint(a.GlobalSequence, 10), true
+	}
+	if f, err := resp.Fork(); err == nil {
+		return fmt.Sprintf("fork:%d:%d:%s", f.StartingBlock, f.EndingBlock, f.NewId), true
+	}
+	return "", false
+}
+
+// agreeing counts the votes identical to payload.
+func agreeing(b *ballot, payload []byte) (n int) {
+	for _, p := range b.votes {
+		if string(p) == string(payload) {
+			n++
+		}
+	}
+	return n
+}
+
+// differingFields lists the paths of every field that is not identical across all of the payloads.
+func differingFields(votes map[int][]byte) []string {
+	flattened := make([]map[string]string, 0, len(votes))
+	for _, payload := range votes {
+		flattened = append(flattened, flatten(payload))
+	}
+	paths := make(map[string]bool)
+	for _, fields := range flattened {
+		for path := range fields {
+			paths[path] = true
+		}
+	}
+
+	differing := make([]string, 0)
+	for path := range paths {
+		value, ok := flattened[0][path]
+		for _, fields := range flattened[1:] {
+			if v, present := fields[path]; v != value || present != ok {
+				differing = append(differing, path)
+				break
+			}
+		}
+	}
+	sort.Strings(differing)
+	return differing
+}
+
+// flatten maps the dotted path of each value in a JSON document to its JSON encoding.
+func flatten(payload []byte) map[string]string {
+	var doc interface{}
+	fields := make(map[string]string)
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return fields
+	}
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			for k, child := range node {
+				walk(strings.TrimPrefix(path+"."+k, "."), child)
+			}
+		case []interface{}:
+			for i, child := range node {
+				walk(path+"."+strconv.Itoa(i), child)
+			}
+		default:
+			b, _ := json.Marshal(node)
+			fields[path] = string(b)
+		}
+	}
+	walk("", doc)
+	return fields
+}
+
+// fieldValue returns the JSON encoding of the field at path, or an empty string if it is missing.
+func fieldValue(payload []byte, path string) string {
+	return flatten(payload)[path]
+}
+
+// QuorumError is sent over the errors channel by a QuorumClient when providers reported differing copies of a trace,
+// or when fewer than Quorum providers agreed before the timeout. Reached is true if the trace was still delivered,
+// and Fields lists each field that differed along with the value reported by each endpoint.
+type QuorumError struct {
+	TrxId          string
+	GlobalSequence uint64
+	Reached        bool
+	Votes          int
+	Quorum         int
+	Fields         []FieldDiff
+}
+
+// FieldDiff is a field that providers disagreed on, Field is its dotted JSON path and Values holds its JSON encoded
+// value keyed by endpoint, which is empty if the endpoint's copy did not include the field.
+type FieldDiff struct {
+	Field  string
+	Values map[string]string
+}
+
+// Error satisfies the error interface
+func (qe QuorumError) Error() string {
+	if len(qe.Fields) == 0 {
+		return fmt.Sprintf("trx %s global sequence %d: only %d of %d required provider(s) reported the trace",
+			qe.TrxId, qe.GlobalSequence, qe.Votes, qe.Quorum)
+	}
+	fields := make([]string, len(qe.Fields))
+	for i := range qe.Fields {
+		fields[i] = qe.Fields[i].Field
+	}
+	return fmt.Sprintf("trx %s global sequence %d: providers disagree on %s (quorum reached: %v)",
+		qe.TrxId, qe.GlobalSequence, strings.Join(fields, ", "), qe.Reached)
+}
@@ -0,0 +1,203 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// quorumFrame is an action trace identified by trx id and global sequence, with the given transfer quantity.
+func quorumFrame(t *testing.T, seq uint64, quantity string) string {
+	t.Helper()
+	a := &ActionTrace{BlockNum: 10, GlobalSequence: seq, TrxId: []byte{0xab, 0xcd}}
+	a.Act.Account = "eosio.token"
+	a.Act.Name = "transfer"
+	a.Act.Data = map[string]interface{}{"quantity": quantity}
+	return traceFrame(t, "action_trace", RespModeLive, a)
+}
+
+// newQuorum starts a QuorumClient over three fake servers, and subscribes it.
+func newQuorum(t *testing.T, timeout time.Duration) (*QuorumClient, []*fakeConn, chan HyperionResponse, chan error) {
+	t.Helper()
+	fakes := []*fakeHyperion{newFakeHyperion(t), newFakeHyperion(t), newFakeHyperion(t)}
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	q, err := NewQuorumClient(context.Background(), Quorum{
+		Endpoints: []string{fakes[0].url(), fakes[1].url(), fakes[2].url()},
+		Timeout:   timeout,
+	}, results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = q.Close()
+	})
+
+	conns := make([]*fakeConn, len(fakes))
+	for i, f := range fakes {
+		conns[i] = f.accept(t)
+	}
+	if err = q.SubscribeActions(context.Background(), NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	for _, fc := range conns {
+		fc.expectRequest(t, "action_stream_request")
+	}
+	return q, conns, results, errs
+}
+
+func TestQuorumAgreement(t *testing.T) {
+	_, conns, results, errs := newQuorum(t, time.Second)
+	conns[0].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	select {
+	case r := <-results:
+		t.Fatal("delivered before quorum:", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conns[1].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GlobalSequence != 1 {
+		t.Errorf("expected global sequence 1, got %d", a.GlobalSequence)
+	}
+
+	// the last provider's copy, or a replay, must not deliver it again:
+	conns[2].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	conns[0].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	select {
+	case r := <-results:
+		t.Fatal("delivered twice:", r)
+	case err = <-errs:
+		t.Fatal("unexpected error:", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestQuorumDisagreement(t *testing.T) {
+	q, conns, results, errs := newQuorum(t, time.Second)
+	conns[0].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	conns[1].send(t, quorumFrame(t, 1, "9.0000 EOS"))
+	conns[2].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Act.Data["quantity"] != "1.0000 EOS" {
+		t.Errorf("expected the majority's copy, got %v", a.Act.Data["quantity"])
+	}
+
+	var qe QuorumError
+	select {
+	case err = <-errs:
+		if !errors.As(err, &qe) {
+			t.Fatalf("expected a QuorumError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a QuorumError")
+	}
+	if !qe.Reached || qe.Votes != 3 || qe.GlobalSequence != 1 || qe.TrxId != "abcd" {
+		t.Errorf("unexpected QuorumError: %+v", qe)
+	}
+	if len(qe.Fields) != 1 || qe.Fields[0].Field != "act.data.quantity" {
+		t.Fatalf("expected act.data.quantity to differ, got %+v", qe.Fields)
+	}
+	endpoints := q.Endpoints()
+	if qe.Fields[0].Values[endpoints[1]] != `"9.0000 EOS"` || qe.Fields[0].Values[endpoints[0]] != `"1.0000 EOS"` {
+		t.Errorf("unexpected values: %v", qe.Fields[0].Values)
+	}
+}
+
+func TestQuorumSlowErrors(t *testing.T) {
+	q, conns, results, _ := newQuorum(t, time.Second)
+	// errs is never read, which must not stall delivery once its buffer is full:
+	for i := uint64(1); i <= 100; i++ {
+		conns[0].send(t, quorumFrame(t, i, "1.0000 EOS"))
+		conns[1].send(t, quorumFrame(t, i, "1.0000 EOS"))
+		conns[2].send(t, quorumFrame(t, i, "9.0000 EOS"))
+		if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != i {
+			t.Fatalf("expected global sequence %d, got %+v", i, a)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().ErrorsDropped == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected errors to be dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQuorumTimeout(t *testing.T) {
+	_, conns, results, errs := newQuorum(t, 200*time.Millisecond)
+	conns[0].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+
+	select {
+	case r := <-results:
+		t.Fatal("delivered without quorum:", r)
+	case err := <-errs:
+		var qe QuorumError
+		if !errors.As(err, &qe) {
+			t.Fatalf("expected a QuorumError, got %v", err)
+		}
+		if qe.Reached || qe.Votes != 1 || qe.Quorum != 2 || len(qe.Fields) != 0 {
+			t.Errorf("unexpected QuorumError: %+v", qe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a QuorumError")
+	}
+}
+
+func TestQuorumShortTimeout(t *testing.T) {
+	_, conns, _, errs := newQuorum(t, time.Nanosecond)
+	conns[0].send(t, quorumFrame(t, 1, "1.0000 EOS"))
+	select {
+	case err := <-errs:
+		if !errors.As(err, new(QuorumError)) {
+			t.Fatalf("expected a QuorumError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a QuorumError")
+	}
+}
+
+func TestQuorumLost(t *testing.T) {
+	q, conns, _, errs := newQuorum(t, time.Second)
+	conns[0].drop()
+	conns[1].drop()
+	select {
+	case <-q.Ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("quorum client was not closed after losing a quorum of providers")
+	}
+	for err := range errs {
+		if _, ok := err.(ExitError); ok {
+			return
+		}
+	}
+}
+
+func TestQuorumInvalid(t *testing.T) {
+	for _, quorum := range []Quorum{{}, {Endpoints: []string{"ws://a"}, Size: 2}, {Endpoints: []string{"ws://a"}, Size: -1},
+		{Endpoints: []string{"ws://a"}, Timeout: -time.Second}} {
+		if _, err := NewQuorumClient(context.Background(), quorum, nil, nil); err == nil {
+			t.Errorf("expected an error for %+v", quorum)
+		}
+	}
+}
+
+func TestDifferingFields(t *testing.T) {
+	fields := differingFields(map[int][]byte{
+		0: []byte(`{"a":1,"b":{"c":[1,2]},"d":"x"}`),
+		1: []byte(`{"a":1,"b":{"c":[1,3]}}`),
+	})
+	if len(fields) != 2 || fields[0] != "b.c.1" || fields[1] != "d" {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	if (QuorumError{}).Error() == "" || (QuorumError{Fields: []FieldDiff{{Field: "a"}}}).Error() == "" {
+		t.Error("err is empty")
+	}
+}
@@ -0,0 +1,146 @@
+package stream
+
+import (
+	"fmt"
+	"nhooyr.io/websocket"
+	"time"
+)
+
+// Backoff controls how a Client configured with WithReconnect waits between attempts to redial Hyperion. The delay
+// starts at Initial and is multiplied by Multiplier after each failed attempt, up to Max. A MaxAttempts of zero will
+// retry forever.
+type Backoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	Multiplier  float64
+	MaxAttempts int
+}
+
+// DefaultBackoff is a reasonable Backoff for public Hyperion endpoints: it starts at one second, doubles, and never
+// waits more than a minute between attempts.
+var DefaultBackoff = Backoff{
+	Initial:    time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+}
+
+// delay returns how long to wait before the numbered (starting at one) attempt.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := float64(b.Initial)
+	for i := 1; i < attempt; i++ {
+		if b.Multiplier > 1 {
+			d *= b.Multiplier
+		}
+		if b.Max > 0 && d >= float64(b.Max) {
+			return b.Max
+		}
+	}
+	return time.Duration(d)
+}
+
+// WithReconnect instructs the Client to redial Hyperion when the websocket fails instead of closing Client.Ctx. The
+// active subscriptions are re-sent with their StartFrom rewritten to the last block delivered for each, and any traces
+// already delivered are discarded when they are replayed. Progress is reported over the errors channel using
+// ReconnectError, ReconnectedError and ReconnectFailedError.
+func WithReconnect(b Backoff) Option {
+	return func(c *Client) {
+		c.backoff = &b
+	}
+}
+
+// redial attempts to reconnect and resubscribe according to the Client's Backoff. It returns nil if the Client was
+// cancelled or has exhausted its attempts.
+func (c *Client) redial(cause error) *websocket.Conn {
+	failed := c.ActiveEndpoint()
+	for attempt := 1; c.backoff.MaxAttempts == 0 || attempt <= c.backoff.MaxAttempts; attempt++ {
+		delay := c.backoff.delay(attempt)
+		c.report(ReconnectError{Attempt: attempt, Delay: delay, Err: cause})
+		select {
+		case <-c.Ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		endpoint, conn, err := c.connect(failed)
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		c.mux.Lock()
+		c.url = endpoint
+		c.conn = conn
+		startFrom := make(map[uint64]interface{})
+		for _, s := range c.subscriptions() {
+			if s.closed {
+				delete(c.subs, s.ID)
+				continue
+			}
+			s.replay = s.block > 0
+			s.mode = ""
+			startFrom[s.ID] = s.startFrom()
+			if err = c.request(s); err != nil {
+				break
+			}
+		}
+		c.mux.Unlock()
+		if err != nil {
+			_ = conn.Close(websocket.StatusNormalClosure, "")
+			cause = err
+			continue
+		}
+
+		c.report(ReconnectedError{Attempt: attempt, Endpoint: endpoint, StartFrom: startFrom})
+		return conn
+	}
+	c.report(ReconnectFailedError{Err: cause})
+	return nil
+}
+
+// ReconnectError is sent over the errors channel when the websocket has failed and the Client is about to wait Delay
+// before redialing. Err holds the reason the previous attempt, or the connection, failed.
+type ReconnectError struct {
+	Attempt int
+	Delay   time.Duration
+	Err     error
+}
+
+// Error satisfies the error interface
+func (r ReconnectError) Error() string {
+	return fmt.Sprintf("reconnect attempt %d in %v: %v", r.Attempt, r.Delay, r.Err)
+}
+
+// Unwrap returns the underlying error
+func (r ReconnectError) Unwrap() error {
+	return r.Err
+}
+
+// ReconnectedError is sent over the errors channel when the Client has successfully redialed and resubscribed,
+// Endpoint is the Hyperion endpoint now in use and StartFrom holds the value sent in each new request keyed by
+// Subscription.ID.
+type ReconnectedError struct {
+	Attempt   int
+	Endpoint  string
+	StartFrom map[uint64]interface{}
+}
+
+// Error satisfies the error interface
+func (r ReconnectedError) Error() string {
+	return fmt.Sprintf("reconnected to %s after %d attempt(s), resumed %d subscription(s)", r.Endpoint, r.Attempt, len(r.StartFrom))
+}
+
+// ReconnectFailedError is sent over the errors channel when the Client has exhausted Backoff.MaxAttempts, it will be
+// followed by an ExitError.
+type ReconnectFailedError struct {
+	Err error
+}
+
+// Error satisfies the error interface
+func (r ReconnectFailedError) Error() string {
+	return "giving up on reconnect: " + r.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (r ReconnectFailedError) Unwrap() error {
+	return r.Err
+}
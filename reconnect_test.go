@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 2}
+	for attempt, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if got := b.delay(attempt); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
+
+func TestReconnectResumes(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errors, WithReconnect(Backoff{Initial: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	fc.expectRequest(t, "action_stream_request")
+	fc.send(t, actionFrame(t, 10, 100))
+	nextResult(t, results)
+	fc.send(t, actionFrame(t, 11, 101))
+	nextResult(t, results)
+	fc.drop()
+
+	fc = f.accept(t)
+	ar := &ActionsReq{}
+	if err = json.Unmarshal([]byte(fc.expectRequest(t, "action_stream_request")), ar); err != nil {
+		t.Fatal(err)
+	}
+	if ar.StartFrom != float64(11) {
+		t.Errorf("expected resubscribe from block 11, got %v", ar.StartFrom)
+	}
+
+	// block 11 is replayed, the duplicate should be discarded:
+	fc.send(t, actionFrame(t, 11, 101))
+	fc.send(t, actionFrame(t, 12, 102))
+	r := nextResult(t, results)
+	if a, _ := r.Action(); a == nil || a.GlobalSequence != 102 {
+		t.Errorf("expected global sequence 102 after reconnect, got %+v", r)
+	}
+
+	var reconnecting, reconnected bool
+	for len(errors) > 0 {
+		switch (<-errors).(type) {
+		case ReconnectError:
+			reconnecting = true
+		case ReconnectedError:
+			reconnected = true
+		}
+	}
+	if !reconnecting || !reconnected {
+		t.Error("reconnect was not reported on the errors channel")
+	}
+}
+
+func TestReconnectEIO4(t *testing.T) {
+	f := newFakeHyperion(t)
+	f.versions = []string{"4"}
+	results := make(chan HyperionResponse)
+	errors := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errors, WithReconnect(Backoff{Initial: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	fc.send(t, actionFrame(t, 10, 100))
+	nextResult(t, results)
+	fc.drop()
+
+	// the resubscribe must wait for the namespace connect, or the server drops it:
+	fc = f.accept(t)
+	fc.expectRequest(t, "action_stream_request")
+	if early := atomic.LoadInt32(&fc.early); early != 0 {
+		t.Fatalf("%d event(s) were sent before connecting to the namespace", early)
+	}
+	fc.send(t, actionFrame(t, 11, 101))
+	if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != 101 {
+		t.Errorf("expected global sequence 101 after reconnect, got %+v", a)
+	}
+}
+
+func TestReconnectErrors(t *testing.T) {
+	switch "" {
+	case ReconnectError{Err: ExitError{}}.Error():
+		t.Error("err is empty")
+		fallthrough
+	case ReconnectedError{}.Error():
+		t.Error("err is empty")
+		fallthrough
+	case ReconnectFailedError{Err: ExitError{}}.Error():
+		t.Error("err is empty")
+	}
+}
@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// WithErrorHandler calls fn with each error instead of sending it over the errors channel. It is called from the
+// goroutine that encountered the error, which may be the websocket reader, so it should return quickly.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(c *Client) {
+		c.errorHandler = fn
+	}
+}
+
+// defaultErrorBuffer is how many errors are buffered without WithErrorBuffer.
+const defaultErrorBuffer = 64
+
+// WithErrorBuffer sets how many errors are buffered while the consumer is busy, which defaults to 64. Errors are sent
+// over the errors channel without ever blocking the Client, any that don't fit are dropped and counted in
+// Stats.ErrorsDropped. Only the final ExitError waits for space, so that it is never dropped. A nil errors channel
+// discards errors.
+func WithErrorBuffer(size int) Option {
+	return func(c *Client) {
+		c.errorQueue = make(chan error, size)
+	}
+}
+
+// WithErrorLogger logs every error to logger, in addition to delivering it. Reconnects are logged at the info level,
+// recoverable errors as warnings, and anything else as an error.
+func WithErrorLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// deliverError passes an error to the consumer according to the error options. It never blocks, except for an
+// ExitError which waits for space in the buffer until done is closed.
+func (c *Client) deliverError(err error, done <-chan struct{}) {
+	if c.logger != nil {
+		c.logError(err)
+	}
+	switch {
+	case c.errorHandler != nil:
+		c.errorHandler(err)
+	case c.errors == nil:
+	case c.errorQueue == nil:
+		// only a Client that wasn't created by NewClient has no buffer:
+		select {
+		case c.errors <- err:
+		case <-done:
+		}
+	default:
+		queueError(c.errorQueue, &c.errorsDropped, err, done)
+	}
+}
+
+// queueError buffers an error for forwardErrors without blocking, counting it in dropped if the buffer is full. An
+// ExitError waits for space until done is closed instead, so that it is never dropped.
+func queueError(queue chan error, dropped *atomic.Uint64, err error, done <-chan struct{}) {
+	if errors.As(err, new(ExitError)) {
+		select {
+		case queue <- err:
+		case <-done:
+		}
+		return
+	}
+	select {
+	case queue <- err:
+	default:
+		dropped.Add(1)
+	}
+}
+
+// forwardErrors sends buffered errors to the consumer until closing is closed, or until ctx is done and the final
+// ExitError has been sent.
+func forwardErrors(ctx context.Context, queue chan error, errs chan error, closing chan struct{}) {
+	for {
+		select {
+		case <-closing:
+			return
+		case err := <-queue:
+			select {
+			case errs <- err:
+			case <-closing:
+				return
+			}
+			if ctx.Err() != nil && errors.As(err, new(ExitError)) {
+				return
+			}
+		}
+	}
+}
+
+// logError writes an error to the logger with a level reflecting its severity.
+func (c *Client) logError(err error) {
+	level := slog.LevelError
+	switch {
+	case errors.As(err, new(ReconnectedError)):
+		level = slog.LevelInfo
+	case errors.As(err, new(ReconnectError)), errors.As(err, new(OversizeMessageError)),
+		errors.As(err, new(StalledError)), errors.As(err, new(PongTimeoutError)), errors.As(err, new(IdleTimeoutError)),
+		errors.As(err, new(AbiMismatchError)), errors.As(err, new(DataError)):
+		level = slog.LevelWarn
+	}
+	c.logger.LogAttrs(context.Background(), level, "hyperion stream error",
+		slog.String("endpoint", c.ActiveEndpoint()),
+		slog.String("type", fmt.Sprintf("%T", err)),
+		slog.Any("error", err),
+	)
+}
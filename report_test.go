@@ -0,0 +1,209 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestErrorHandler(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	handled := make(chan error, 16)
+	c, err := NewClient(f.url(), results, nil, WithSkipOversize(), WithErrorHandler(func(err error) {
+		handled <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	fc.send(t, bigActionFrame(t, 1, 1))
+	select {
+	case err = <-handled:
+		if !errors.As(err, new(OversizeMessageError)) {
+			t.Errorf("expected an OversizeMessageError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the error handler")
+	}
+}
+
+func TestErrorBuffer(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	// nothing reads errs until the end of the test:
+	errs := make(chan error)
+	c, err := NewClient(f.url(), results, errs, WithSkipOversize(), WithErrorBuffer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		fc.send(t, bigActionFrame(t, 1, uint64(i)))
+	}
+	fc.send(t, actionFrame(t, 1, 10))
+	a, err := nextResult(t, results).Action()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GlobalSequence != 10 {
+		t.Errorf("expected the trace after the oversized ones, got %d", a.GlobalSequence)
+	}
+	// at most one error is held by forwardErrors and one in the buffer, the rest are dropped:
+	if dropped := c.Stats().ErrorsDropped; dropped < 2 || dropped > 3 {
+		t.Errorf("expected 2 or 3 dropped errors, got %d", dropped)
+	}
+	select {
+	case err = <-errs:
+		if !errors.As(err, new(OversizeMessageError)) {
+			t.Errorf("expected an OversizeMessageError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a buffered error")
+	}
+}
+
+func TestErrorDefaultBuffer(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	// errs is never read, which must not stall the stream:
+	c, err := NewClient(f.url(), results, make(chan error), WithSkipOversize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < defaultErrorBuffer+4; i++ {
+		fc.send(t, bigActionFrame(t, 1, uint64(i)))
+	}
+	fc.send(t, actionFrame(t, 1, 1000))
+	if a, _ := nextResult(t, results).Action(); a == nil || a.GlobalSequence != 1000 {
+		t.Errorf("expected the trace after the oversized ones, got %+v", a)
+	}
+	if dropped := c.Stats().ErrorsDropped; dropped < 2 {
+		t.Errorf("expected errors to be dropped, got %d", dropped)
+	}
+}
+
+func TestErrorsAfterShutdown(t *testing.T) {
+	f := newFakeHyperion(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 16)
+	c, err := NewClientWithContext(ctx, f.url(), make(chan HyperionResponse), errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.accept(t)
+
+	// the Client shuts itself down and Close is never called:
+	cancel()
+	select {
+	case err = <-errs:
+		if !errors.As(err, new(ExitError)) {
+			t.Fatalf("expected an ExitError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the ExitError")
+	}
+	exited := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Client's goroutines did not exit after it shut down")
+	}
+}
+
+func TestNilErrors(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	c, err := NewClient(f.url(), results, nil, WithSkipOversize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, bigActionFrame(t, 1, 1))
+	fc.send(t, actionFrame(t, 1, 2))
+	if _, err = nextResult(t, results).Action(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that may be written by the Client while the test reads it.
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.buf.String()
+}
+
+func TestErrorLogger(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	logs := &syncBuffer{}
+	c, err := NewClient(f.url(), results, errs, WithSkipOversize(),
+		WithErrorLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	fc.send(t, bigActionFrame(t, 1, 1))
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the error should still be delivered when logging")
+	}
+
+	var record struct {
+		Level    string `json:"level"`
+		Endpoint string `json:"endpoint"`
+		Type     string `json:"type"`
+		Error    string `json:"error"`
+	}
+	if err = json.Unmarshal([]byte(logs.String()), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", logs.String(), err)
+	}
+	if record.Level != "WARN" {
+		t.Errorf("expected an oversized message to be logged as a warning, got %s", record.Level)
+	}
+	if record.Endpoint != f.url() || record.Type != "stream.OversizeMessageError" || record.Error == "" {
+		t.Errorf("unexpected attributes: %+v", record)
+	}
+}
@@ -0,0 +1,294 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nhooyr.io/websocket"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeHyperion is a minimal socket.io server used to drive a Client in tests. Each accepted websocket is sent over
+// conns so the test can script the conversation.
+type fakeHyperion struct {
+	srv     *httptest.Server
+	conns   chan *fakeConn
+	headers chan http.Header
+
+	// open is the Engine.IO handshake sent to each websocket, and noPong stops the server replying to pings.
+	open   string
+	noPong bool
+
+	// versions lists the Engine.IO versions accepted, others are rejected with a bad request. Engine.IO v4 clients
+	// must connect to the namespace, and are sent a ping every pingEvery if set.
+	versions  []string
+	pingEvery time.Duration
+
+	// health is the response to /v2/health, and healthStatus its status code.
+	health       string
+	healthStatus int
+
+	// ack builds the reply to a stream request, it defaults to accepting every request. No reply is sent if it
+	// returns an empty string.
+	ack func(event string, body string) string
+}
+
+// fakeConn is a single websocket accepted by fakeHyperion, frames holds everything received other than answered
+// pings and pongs, which are counted instead. Like socket.io v4, events sent over Engine.IO v4 before the namespace
+// connect are dropped, and counted in early.
+type fakeConn struct {
+	ws     *websocket.Conn
+	eio    string
+	frames chan string
+	pings  int32
+	pongs  int32
+	early  int32
+	ctx    context.Context
+	cancel func()
+}
+
+func newFakeHyperion(t *testing.T) *fakeHyperion {
+	f := &fakeHyperion{}
+	f.srv = httptest.NewServer(f.handler())
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// newFakeHyperionTLS is a fakeHyperion listening for wss:// connections using a self-signed certificate.
+func newFakeHyperionTLS(t *testing.T) *fakeHyperion {
+	f := &fakeHyperion{}
+	f.srv = httptest.NewTLSServer(f.handler())
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// handler accepts websockets and performs the socket.io handshake.
+func (f *fakeHyperion) handler() http.Handler {
+	f.conns = make(chan *fakeConn, 8)
+	f.headers = make(chan http.Header, 8)
+	f.open = `0{"sid":"fake","upgrades":[],"pingInterval":25000,"pingTimeout":20000}`
+	f.versions = []string{"3"}
+	f.health = `{"health":[{"service":"RabbitMq","status":"OK"},{"service":"NodeosRPC","status":"OK"}]}`
+	f.healthStatus = http.StatusOK
+	f.ack = func(string, string) string {
+		return `{"status":"OK"}`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/health" {
+			w.WriteHeader(f.healthStatus)
+			_, _ = w.Write([]byte(f.health))
+			return
+		}
+		select {
+		case f.headers <- r.Header:
+		default:
+		}
+		eio := r.URL.Query().Get("EIO")
+		if !hasString(f.versions, eio) {
+			http.Error(w, `{"code":5,"message":"Unsupported protocol version"}`, http.StatusBadRequest)
+			return
+		}
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		fc := &fakeConn{ws: ws, eio: eio, frames: make(chan string, 64)}
+		fc.ctx, fc.cancel = context.WithCancel(context.Background())
+		defer fc.cancel()
+
+		_ = ws.Write(fc.ctx, websocket.MessageText, []byte(f.open))
+		if eio == "3" {
+			// socket.io v2 connects to the default namespace on its own:
+			_ = ws.Write(fc.ctx, websocket.MessageText, []byte(`40`))
+		} else if f.pingEvery > 0 {
+			go fc.ping(f.pingEvery)
+		}
+		f.conns <- fc
+		connected := eio == "3"
+		for {
+			_, m, err := ws.Read(fc.ctx)
+			if err != nil {
+				return
+			}
+			if eio == "4" && string(m) == "40" {
+				connected = true
+				_ = ws.Write(fc.ctx, websocket.MessageText, []byte(`40{"sid":"fake-namespace"}`))
+			}
+			if !connected && strings.HasPrefix(string(m), "42") {
+				atomic.AddInt32(&fc.early, 1)
+				continue
+			}
+			if eio == "4" && string(m) == "3" {
+				atomic.AddInt32(&fc.pongs, 1)
+				continue
+			}
+			if string(m) == "2" {
+				if f.noPong {
+					fc.frames <- string(m)
+					continue
+				}
+				atomic.AddInt32(&fc.pings, 1)
+				_ = ws.Write(fc.ctx, websocket.MessageText, []byte("3"))
+				continue
+			}
+			if req := requestPattern.FindStringSubmatch(string(m)); req != nil {
+				if reply := f.ack(req[2], req[3]); reply != "" {
+					_ = ws.Write(fc.ctx, websocket.MessageText, []byte("43"+req[1]+"["+reply+"]"))
+				}
+			}
+			fc.frames <- string(m)
+		}
+	})
+}
+
+// ping sends Engine.IO v4 pings until the websocket is closed.
+func (fc *fakeConn) ping(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fc.ctx.Done():
+			return
+		case <-ticker.C:
+			_ = fc.ws.Write(fc.ctx, websocket.MessageText, []byte("2"))
+		}
+	}
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// requestPattern matches a socket.io event sent with an ack id, capturing the id, event name and body.
+var requestPattern = regexp.MustCompile(`^42(\d+)\["([a-z_]+)",(.*)\]$`)
+
+// url is the websocket address of the server.
+func (f *fakeHyperion) url() string {
+	return "ws" + strings.TrimPrefix(f.srv.URL, "http")
+}
+
+// accept waits for the next websocket.
+func (f *fakeHyperion) accept(t *testing.T) *fakeConn {
+	t.Helper()
+	select {
+	case fc := <-f.conns:
+		return fc
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a connection")
+	}
+	return nil
+}
+
+// expect waits for a frame starting with prefix, discarding any others.
+func (fc *fakeConn) expect(t *testing.T, prefix string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-fc.frames:
+			if strings.HasPrefix(m, prefix) {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a frame starting with %q", prefix)
+		}
+	}
+}
+
+// expectRequest waits for a stream request event, returning its JSON body.
+func (fc *fakeConn) expectRequest(t *testing.T, event string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-fc.frames:
+			if req := requestPattern.FindStringSubmatch(m); req != nil && req[2] == event {
+				return req[3]
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", event)
+		}
+	}
+}
+
+// send writes a text frame to the client.
+func (fc *fakeConn) send(t *testing.T, m string) {
+	t.Helper()
+	if err := fc.ws.Write(fc.ctx, websocket.MessageText, []byte(m)); err != nil {
+		t.Fatal("fake server write:", err)
+	}
+}
+
+// drop abruptly closes the websocket.
+func (fc *fakeConn) drop() {
+	_ = fc.ws.Close(websocket.StatusGoingAway, "")
+	fc.cancel()
+}
+
+// traceFrame wraps a trace in the socket.io event Hyperion uses to deliver it.
+func traceFrame(t *testing.T, traceType string, mode ResponseMode, trace interface{}) string {
+	t.Helper()
+	inner, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer, err := json.Marshal([]interface{}{"message", map[string]interface{}{
+		"type":    traceType,
+		"mode":    mode,
+		"message": string(inner),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "42" + string(outer)
+}
+
+// actionFrame is a minimal action trace message for the given block and global sequence.
+func actionFrame(t *testing.T, block uint32, seq uint64) string {
+	t.Helper()
+	a := &ActionTrace{BlockNum: block, GlobalSequence: seq}
+	a.Act.Account = "eosio.token"
+	a.Act.Name = "transfer"
+	return traceFrame(t, "action_trace", RespModeLive, a)
+}
+
+// deltaFrame is a minimal delta trace message for the given block and primary key.
+func deltaFrame(t *testing.T, block uint32, key string) string {
+	t.Helper()
+	return traceFrame(t, "delta_trace", RespModeLive, &DeltaTrace{
+		Code:       "eosio.token",
+		Scope:      "eosio.token",
+		Table:      "accounts",
+		PrimaryKey: key,
+		BlockNum:   block,
+		Present:    true,
+	})
+}
+
+// libFrame is a lib_update event for the given block.
+func libFrame(block uint32) string {
+	return fmt.Sprintf(`42["lib_update",{"chain_id":"abc","block_num":%d,"block_id":"def"}]`, block)
+}
+
+// nextResult waits for a result, failing the test if none arrives.
+func nextResult(t *testing.T, results chan HyperionResponse) HyperionResponse {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a result")
+	}
+	return nil
+}
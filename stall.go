@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// WithStallDetection watches for Hyperion falling silent or behind while the websocket stays open. A StalledError is
+// sent over the errors channel, once for each stall, if Client.LibNum has not advanced for d, or if the last live
+// trace arrived more than d after its block time. With reconnect set the websocket is instead considered failed,
+// which will cause a reconnect when using WithReconnect, or a failover with NewFailoverClient, and otherwise shuts
+// down the Client. The StalledError is then wrapped in the ReconnectError.
+func WithStallDetection(d time.Duration, reconnect bool) Option {
+	return func(c *Client) {
+		c.stallAfter = d
+		c.stallReconnect = reconnect
+	}
+}
+
+// progress records when lib last advanced, the block of the last trace received, and how far behind the wall clock
+// the last live trace was, for stall detection.
+type progress struct {
+	libAdvanced atomic.Int64
+	lastBlock   atomic.Uint32
+	lastTrace   atomic.Int64
+	lag         atomic.Int64
+}
+
+// advanceLib records that lib moved forward.
+func (p *progress) advanceLib() {
+	p.libAdvanced.Store(time.Now().UnixNano())
+}
+
+// traced records the block of a trace as it is received, and for a live trace how long after its block time it
+// arrived. Traces replayed from history are expected to be behind, so they leave the lag unchanged.
+func (p *progress) traced(resp HyperionResponse) {
+	block := blockNum(resp)
+	if block == 0 {
+		return
+	}
+	now := time.Now()
+	p.lastBlock.Store(block)
+	p.lastTrace.Store(now.UnixNano())
+	if resp.Mode() != RespModeLive {
+		return
+	}
+	if at, ok := blockTime(resp); ok {
+		lag := now.Sub(at)
+		if lag < 0 {
+			lag = 0
+		}
+		p.lag.Store(int64(lag))
+	}
+}
+
+// blockTime returns the block time of a trace, if it has a valid timestamp.
+func blockTime(resp HyperionResponse) (time.Time, bool) {
+	var at time.Time
+	var err error
+	switch r := resp.(type) {
+	case *ActionTrace:
+		at, err = r.Time()
+	case *DeltaTrace:
+		at, err = r.Time()
+	default:
+		return at, false
+	}
+	return at, err == nil
+}
+
+// stalled returns a StalledError if lib has not advanced for the stall duration, measured from when the websocket
+// was opened if lib has not advanced since, or if the last live trace lagged the wall clock by at least as long.
+func (c *Client) stalled(opened time.Time) error {
+	advanced := time.Unix(0, c.progress.libAdvanced.Load())
+	if advanced.Before(opened) {
+		advanced = opened
+	}
+	lag := time.Duration(c.progress.lag.Load())
+	libStalled := time.Since(advanced) >= c.stallAfter
+	if !libStalled && lag < c.stallAfter {
+		return nil
+	}
+	s := StalledError{
+		Endpoint:  c.ActiveEndpoint(),
+		LibNum:    atomic.LoadUint32(&c.LibNum),
+		Since:     advanced,
+		LastBlock: c.progress.lastBlock.Load(),
+	}
+	if !libStalled {
+		s.Lag = lag
+	}
+	if last := c.progress.lastTrace.Load(); last > 0 {
+		s.LastTrace = time.Unix(0, last)
+	}
+	return s
+}
+
+// StalledError is sent when Client.LibNum has not advanced within the duration set by WithStallDetection, or when
+// live traces are arriving that far behind their block time. Since is when lib last advanced, or when the websocket
+// was opened. Lag is how long after its block time the last live trace arrived, it is only set when lib is still
+// advancing and the stall is due to the lag. LastBlock and LastTrace are the block of the last trace received and when
+// it arrived, LastTrace is zero if no traces have been received.
+type StalledError struct {
+	Endpoint  string
+	LibNum    uint32
+	Since     time.Time
+	Lag       time.Duration
+	LastBlock uint32
+	LastTrace time.Time
+}
+
+// Error satisfies the error interface
+func (s StalledError) Error() string {
+	msg := fmt.Sprintf("%s has stalled: lib %d has not advanced for %s", s.Endpoint, s.LibNum, time.Since(s.Since).Round(time.Millisecond))
+	if s.Lag > 0 {
+		msg = fmt.Sprintf("%s has stalled: live traces are arriving %s behind their block time", s.Endpoint, s.Lag.Round(time.Millisecond))
+	}
+	if !s.LastTrace.IsZero() {
+		msg += fmt.Sprintf(", last trace was block %d %s ago", s.LastBlock, time.Since(s.LastTrace).Round(time.Millisecond))
+	}
+	return msg
+}
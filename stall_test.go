@@ -0,0 +1,151 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStallDetection(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithStallDetection(200*time.Millisecond, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+
+	// lib advancing keeps the stream healthy, even if no traces arrive:
+	for lib := uint32(1); lib <= 6; lib++ {
+		fc.send(t, libFrame(lib))
+		time.Sleep(80 * time.Millisecond)
+	}
+	if len(errs) > 0 {
+		t.Fatal("unexpected error:", <-errs)
+	}
+
+	// repeating the same lib is a stall:
+	fc.send(t, actionFrame(t, 7, 1))
+	nextResult(t, results)
+	fc.send(t, libFrame(6))
+	var stalled StalledError
+	select {
+	case err = <-errs:
+		if !errors.As(err, &stalled) {
+			t.Fatalf("expected a StalledError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a StalledError")
+	}
+	if stalled.LibNum != 6 || stalled.LastBlock != 7 || stalled.LastTrace.IsZero() || stalled.Endpoint != f.url() {
+		t.Errorf("unexpected StalledError: %+v", stalled)
+	}
+	if time.Since(stalled.Since) < 200*time.Millisecond {
+		t.Errorf("stalled too early, lib advanced at %v", stalled.Since)
+	}
+
+	// reported once per stall, and the connection is kept:
+	time.Sleep(300 * time.Millisecond)
+	if len(errs) > 0 {
+		t.Error("stall was reported more than once:", <-errs)
+	}
+	if c.Ctx.Err() != nil {
+		t.Error("connection was closed")
+	}
+
+	// after recovering, a new stall is reported again:
+	fc.send(t, libFrame(7))
+	select {
+	case err = <-errs:
+		if !errors.As(err, &stalled) || stalled.LibNum != 7 {
+			t.Fatalf("expected a StalledError at lib 7, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the second StalledError")
+	}
+}
+
+func TestStallReconnect(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs,
+		WithStallDetection(100*time.Millisecond, true),
+		WithReconnect(Backoff{Initial: 10 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	f.accept(t)
+	f.accept(t)
+
+	var reconnect ReconnectError
+	if err = <-errs; !errors.As(err, &reconnect) {
+		t.Fatalf("expected a ReconnectError, got %v", err)
+	}
+	if !errors.As(reconnect.Err, new(StalledError)) {
+		t.Errorf("expected the reconnect to be caused by a stall, got %v", reconnect.Err)
+	}
+}
+
+func TestStallHeadLag(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs, WithStallDetection(200*time.Millisecond, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	late := func(block uint32) *ActionTrace {
+		a := &ActionTrace{BlockNum: block, GlobalSequence: uint64(block), TS: time.Now().Add(-time.Minute).UTC().Format(timestampLayout)}
+		a.Act.Account = "eosio.token"
+		a.Act.Name = "transfer"
+		return a
+	}
+
+	// history is expected to be behind, and lib keeps advancing:
+	fc.send(t, traceFrame(t, "action_trace", RespModeHist, late(1)))
+	nextResult(t, results)
+	for lib := uint32(1); lib <= 6; lib++ {
+		fc.send(t, libFrame(lib))
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(errs) > 0 {
+		t.Fatal("unexpected error:", <-errs)
+	}
+
+	// a live trace arriving a minute after its block is a stall, even though lib is still advancing:
+	fc.send(t, traceFrame(t, "action_trace", RespModeLive, late(2)))
+	nextResult(t, results)
+	var stalled StalledError
+	for lib := uint32(7); len(errs) == 0; lib++ {
+		if lib > 100 {
+			t.Fatal("timed out waiting for a StalledError")
+		}
+		fc.send(t, libFrame(lib))
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err = <-errs; !errors.As(err, &stalled) {
+		t.Fatalf("expected a StalledError, got %v", err)
+	}
+	if stalled.Lag < time.Minute || stalled.Lag > 2*time.Minute || stalled.LastBlock != 2 {
+		t.Errorf("unexpected StalledError: %+v", stalled)
+	}
+}
+
+func TestStalledError(t *testing.T) {
+	if (StalledError{}).Error() == "" || (StalledError{LastTrace: time.Now()}).Error() == "" || (StalledError{Lag: time.Minute}).Error() == "" {
+		t.Error("err is empty")
+	}
+}
@@ -2,7 +2,9 @@ package stream
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/eoscanada/eos-go"
+	"strconv"
 )
 
 // DeltasReq is the query sent to Hyperion requesting a stream of table updates.
@@ -13,6 +15,9 @@ type DeltasReq struct {
 	Payer     eos.AccountName `json:"payer"`
 	StartFrom interface{}     `json:"start_from"` // number or string
 	ReadUntil interface{}     `json:"read_until"` // number or string
+
+	// Predicate is checked by the Client against each trace before it is delivered, see Matching.
+	Predicate *Predicate `json:"-"`
 }
 
 // NewDeltasReq is a request for table updates starting at the current head block.
@@ -81,6 +86,14 @@ type ActionsReq struct {
 	Filters   []*ReqFilter    `json:"filters"`
 	StartFrom interface{}     `json:"start_from"`
 	ReadUntil interface{}     `json:"read_until"`
+
+	// FilterOp combines the Filters, which are all required to match if it is empty. IgnoreDeltas asks Hyperion not
+	// to include each action's table deltas.
+	FilterOp     FilterOp `json:"filter_op,omitempty"`
+	IgnoreDeltas bool     `json:"ignore_deltas,omitempty"`
+
+	// Predicate is checked by the Client against each trace before it is delivered, see Matching.
+	Predicate *Predicate `json:"-"`
 }
 
 // NewActionsReq is a request for action traces starting at the current head block.
@@ -125,7 +138,8 @@ func nar(contract string, account string, action string, startRFC3339 string, en
 	return a
 }
 
-// AddFilter assists in appending a ReqFilter to the request.
+// AddFilter assists in appending a ReqFilter to the request, see also Where. The filter is not checked until the
+// request is sent, or Validate is called.
 func (ar *ActionsReq) AddFilter(f *ReqFilter) (ok bool) {
 	if f == nil {
 		return false
@@ -153,6 +167,8 @@ const (
 	RespActionType ResponseType = "action"
 	// RespDeltaType denotes a delta (table update) record sent by Hyperion
 	RespDeltaType ResponseType = "delta"
+	// RespForkType denotes a microfork notification sent by Hyperion
+	RespForkType ResponseType = "fork"
 
 	// RespModeLive denotes data is being received in near-real-time
 	RespModeLive ResponseMode = "live"
@@ -161,16 +177,29 @@ const (
 )
 
 // HyperionResponse is the data being streamed over the results channel of the stream.Client it can be one of
-// (at current) two types.
+// (at current) three types.
 type HyperionResponse interface {
 	Type() ResponseType
 	Mode() ResponseMode
+	Envelope() Envelope
+	RawJSON() json.RawMessage
 	Action() (*ActionTrace, error)
 	Delta() (*DeltaTrace, error)
+	Fork() (*ForkEvent, error)
+}
+
+// Envelope holds the fields of the socket.io message Hyperion wrapped a trace in. Type is the raw message type, such
+// as "action_trace", and Mode is whether the trace is live or being replayed from history. Any fields not known to
+// this library are kept in Extra as decoded JSON.
+type Envelope struct {
+	Type  string
+	Mode  ResponseMode
+	Extra map[string]interface{}
 }
 
 // ActionTrace holds a trace response, it differs somewhat for standard EOSIO structures. Note that the
-// ActionTrace.Act.Data field is a map[string]interface that will mirror the raw JSON sent by Hyperion.
+// ActionTrace.Act.Data field is a map[string]interface that will mirror the raw JSON sent by Hyperion, which is kept
+// in Act.RawData. Use DecodeData to decode it into a struct.
 type ActionTrace struct {
 	ActionOrdinal        uint32            `json:"action_ordinal"`
 	CreatorActionOrdinal uint32            `json:"creator_action_ordinal"`
@@ -190,16 +219,79 @@ type ActionTrace struct {
 		Name          eos.ActionName         `json:"name"`
 		Authorization []eos.PermissionLevel  `json:"authorization"`
 		Data          map[string]interface{} `json:"data"`
+		RawData       json.RawMessage        `json:"-"`
+		// Extra holds any fields of act that are not decoded above, such as hex_data.
+		Extra map[string]json.RawMessage `json:"-"`
 	} `json:"act"`
 
-	Receipts []struct {
-		Receiver       eos.AccountName       `json:"receiver"`
-		GlobalSequence string                `json:"global_sequence"`
-		RecvSequence   string                `json:"recv_sequence"`
-		AuthSequence   []eos.PermissionLevel `json:"auth_sequence"`
-	} `json:"receipts"`
+	Receipts []Receipt `json:"receipts"`
+
+	// Raw is the JSON Hyperion sent, and Extra holds any of its top level fields that are not decoded above. Extra,
+	// Act.Extra and the Extra of each Receipt are included when the trace is encoded to JSON.
+	Raw   json.RawMessage            `json:"-"`
+	Extra map[string]json.RawMessage `json:"-"`
+
+	mode     ResponseMode
+	envelope Envelope
+}
+
+// Receipt is an action receipt for one of the accounts an action was delivered to. Hyperion sends the sequences as
+// strings, see GlobalSeq and RecvSeq.
+type Receipt struct {
+	Receiver       eos.AccountName `json:"receiver"`
+	GlobalSequence string          `json:"global_sequence"`
+	RecvSequence   string          `json:"recv_sequence"`
+	AuthSequence   []AuthSequence  `json:"auth_sequence"`
+
+	// Extra holds any fields that are not decoded above, such as code_sequence.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// AuthSequence is the number of actions an account has authorized, as of the action a Receipt is for.
+type AuthSequence struct {
+	Account  eos.AccountName
+	Sequence uint64
+}
+
+// UnmarshalJSON accepts the {"account":"name","sequence":"1"} objects sent by Hyperion, with the sequence as either a
+// string or a number, as well as the ["name",1] pairs used by nodeos.
+func (as *AuthSequence) UnmarshalJSON(b []byte) error {
+	var pair []json.RawMessage
+	if json.Unmarshal(b, &pair) == nil {
+		if len(pair) != 2 {
+			return fmt.Errorf("auth_sequence should be an [account, sequence] pair, got %s", b)
+		}
+		if err := json.Unmarshal(pair[0], &as.Account); err != nil {
+			return err
+		}
+		return as.unmarshalSequence(pair[1])
+	}
+	var obj struct {
+		Account  eos.AccountName `json:"account"`
+		Sequence json.RawMessage `json:"sequence"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+	as.Account = obj.Account
+	return as.unmarshalSequence(obj.Sequence)
+}
+
+func (as *AuthSequence) unmarshalSequence(b json.RawMessage) error {
+	var n eos.Uint64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("invalid auth_sequence sequence %s: %w", b, err)
+	}
+	as.Sequence = uint64(n)
+	return nil
+}
 
-	mode ResponseMode
+// MarshalJSON writes the same format Hyperion sends, with the sequence as a string.
+func (as AuthSequence) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Account  eos.AccountName `json:"account"`
+		Sequence string          `json:"sequence"`
+	}{as.Account, strconv.FormatUint(as.Sequence, 10)})
 }
 
 // Type satisfies the HyperionResponse interface and will return what type of trace this is.
@@ -212,6 +304,16 @@ func (act *ActionTrace) Mode() ResponseMode {
 	return act.mode
 }
 
+// Envelope satisfies the HyperionResponse interface and will return the message fields the trace was sent with
+func (act *ActionTrace) Envelope() Envelope {
+	return act.envelope
+}
+
+// RawJSON satisfies the HyperionResponse interface and will return the JSON Hyperion sent the trace as
+func (act *ActionTrace) RawJSON() json.RawMessage {
+	return act.Raw
+}
+
 // Action satisfies the HyperionResponse interface and will return a stream.ActionTrace if this is an action, otherwise
 // it will return an error
 func (act *ActionTrace) Action() (*ActionTrace, error) {
@@ -224,6 +326,12 @@ func (act *ActionTrace) Delta() (*DeltaTrace, error) {
 	return nil, NotDeltaError{}
 }
 
+// Fork satisfies the HyperionResponse interface and will return a stream.ForkEvent if this is a fork, otherwise
+// it will return an error
+func (act *ActionTrace) Fork() (*ForkEvent, error) {
+	return nil, NotForkError{}
+}
+
 // ToJson marshals an ActionTrace to JSON
 func (act *ActionTrace) ToJson() []byte {
 	if act == nil {
@@ -248,7 +356,15 @@ type DeltaTrace struct {
 	BlockNum   uint32          `json:"block_num"`
 	BlockId    eos.HexBytes    `json:"block_id"`
 	Data       interface{}     `json:"data"` // most likely map[string]interface{} or string
-	mode       ResponseMode
+	RawData    json.RawMessage `json:"-"`    // the JSON that Data was decoded from
+
+	// Raw is the JSON Hyperion sent, and Extra holds any of its top level fields that are not decoded above. Extra is
+	// included when the trace is encoded to JSON.
+	Raw   json.RawMessage            `json:"-"`
+	Extra map[string]json.RawMessage `json:"-"`
+
+	mode     ResponseMode
+	envelope Envelope
 }
 
 // Type satisfies the HyperionResponse interface and will return what type of trace this is.
@@ -261,6 +377,16 @@ func (d *DeltaTrace) Mode() ResponseMode {
 	return d.mode
 }
 
+// Envelope satisfies the HyperionResponse interface and will return the message fields the trace was sent with
+func (d *DeltaTrace) Envelope() Envelope {
+	return d.envelope
+}
+
+// RawJSON satisfies the HyperionResponse interface and will return the JSON Hyperion sent the trace as
+func (d *DeltaTrace) RawJSON() json.RawMessage {
+	return d.Raw
+}
+
 // Action satisfies the HyperionResponse interface and will return a stream.ActionTrace if this is an action, otherwise
 // it will return an error
 func (d *DeltaTrace) Action() (*ActionTrace, error) {
@@ -273,6 +399,12 @@ func (d *DeltaTrace) Delta() (*DeltaTrace, error) {
 	return d, nil
 }
 
+// Fork satisfies the HyperionResponse interface and will return a stream.ForkEvent if this is a fork, otherwise
+// it will return an error
+func (d *DeltaTrace) Fork() (*ForkEvent, error) {
+	return nil, NotForkError{}
+}
+
 // ToJson marshals a DeltaTrace to JSON
 func (d *DeltaTrace) ToJson() []byte {
 	if d == nil {
@@ -301,6 +433,14 @@ func (NotDeltaError) Error() string {
 	return "not a delta"
 }
 
+// NotForkError is used when HyperionResponse.Fork() is used on a trace
+type NotForkError struct{}
+
+// Error satisfies the error interface
+func (NotForkError) Error() string {
+	return "not a fork"
+}
+
 // UnknownTypeError is used when an unknown trace message is received
 type UnknownTypeError struct{}
 
@@ -70,7 +70,7 @@ func TestDeltaMsg(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	results := make(chan HyperionResponse)
 	errors := make(chan error)
-	client := &Client{}
+	client := &Client{Ctx: ctx, incoming: results, errors: errors}
 
 	go func() {
 		for {
@@ -110,7 +110,9 @@ func TestDeltaMsg(t *testing.T) {
 				if len(b) < 256 {
 					t.Error("json was too small")
 				}
-				_ = message.Mode()
+				if message.Mode() != RespModeLive {
+					t.Error("expected live mode, got", message.Mode())
+				}
 
 				cancel()
 			}
@@ -123,7 +125,7 @@ func TestDeltaMsg(t *testing.T) {
 		t.Error("empty delta returned json")
 	}
 
-	raw, ok := getRaw([]byte(deltaTraceMessage), client, errors)
+	raw, ok := getRaw([]byte(deltaTraceMessage), client)
 	switch true {
 	case !ok:
 		t.Error("delta trace did not parse correctly")
@@ -147,7 +149,7 @@ func TestDeltaMsg(t *testing.T) {
 		t.Error("raw[0] did not contain a string")
 		return
 	}
-	sendResult(raw, results, errors)
+	client.sendResult(raw)
 
 	<-ctx.Done()
 }
@@ -161,7 +163,7 @@ func TestActionMsg(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	results := make(chan HyperionResponse)
 	errors := make(chan error)
-	client := &Client{}
+	client := &Client{Ctx: ctx, incoming: results, errors: errors}
 	wantError := true
 
 	go func() {
@@ -197,6 +199,11 @@ func TestActionMsg(t *testing.T) {
 					cancel()
 				}
 
+				if len(act.Receipts) != 1 || len(act.Receipts[0].AuthSequence) != 1 ||
+					act.Receipts[0].AuthSequence[0] != (AuthSequence{Account: "m.federation", Sequence: 50649143}) {
+					t.Errorf("unexpected receipts: %+v", act.Receipts)
+				}
+
 				b := act.ToJson()
 				if b == nil {
 					t.Error("got nil json")
@@ -206,7 +213,9 @@ func TestActionMsg(t *testing.T) {
 					t.Error("json was too small")
 				}
 
-				_ = message.Mode()
+				if message.Mode() != RespModeLive {
+					t.Error("expected live mode, got", message.Mode())
+				}
 				cancel()
 			}
 		}
@@ -219,7 +228,7 @@ func TestActionMsg(t *testing.T) {
 	}
 
 	// LIB update message:
-	raw, ok := getRaw([]byte(libUpdateMessage), client, errors)
+	raw, ok := getRaw([]byte(libUpdateMessage), client)
 	switch true {
 	case ok:
 		t.Error("lib update should not return true")
@@ -231,9 +240,9 @@ func TestActionMsg(t *testing.T) {
 		t.Error("client lib did not update")
 	}
 	// this *will* cause an error, it's not a trace:
-	sendResult(raw, results, errors)
+	client.sendResult(raw)
 
-	raw, ok = getRaw([]byte(actionTraceMessage), client, errors)
+	raw, ok = getRaw([]byte(actionTraceMessage), client)
 	switch true {
 	case !ok:
 		t.Error("action trace did not parse correctly")
@@ -260,11 +269,46 @@ func TestActionMsg(t *testing.T) {
 
 	// this should not cause an error, it really is a trace
 	wantError = false
-	sendResult(raw, results, errors)
+	client.sendResult(raw)
 
 	<-ctx.Done()
 }
 
+func TestEnvelope(t *testing.T) {
+	const historyMessage = `42["message",{"type":"delta_trace","mode":"history","reqUUID":"abc","messages":[{"code":"a","scope":"b","table":"c","block_num":1},{"code":"a","scope":"b","table":"c","block_num":2}]}]`
+
+	raw, err := parseRaw([]byte(historyMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses, err := decodeResult(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("expected 2 deltas from history batch, got %d", len(responses))
+	}
+	for i, r := range responses {
+		d, err := r.Delta()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.BlockNum != uint32(i+1) {
+			t.Errorf("expected block %d, got %d", i+1, d.BlockNum)
+		}
+		if r.Mode() != RespModeHist {
+			t.Error("expected history mode, got", r.Mode())
+		}
+		env := r.Envelope()
+		if env.Type != "delta_trace" || env.Mode != RespModeHist {
+			t.Errorf("incorrect envelope %+v", env)
+		}
+		if env.Extra["reqUUID"] != "abc" {
+			t.Error("unknown envelope field was not kept")
+		}
+	}
+}
+
 func Test_Error(t *testing.T) {
 	switch "" {
 	case NotActionError{}.Error():
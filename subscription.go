@@ -0,0 +1,257 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// recentSize is how many trace identities a Subscription remembers in order to discard duplicates.
+const recentSize = 4096
+
+// Subscription is a single stream request sent over a Client's websocket. Hyperion does not label which request a
+// trace belongs to, so traces are routed to every Subscription whose request they match, and any trace that matches
+// none of them is sent to the Client's results channel.
+type Subscription struct {
+	// ID uniquely identifies the Subscription within its Client.
+	ID uint64
+	// Actions is the request for an action subscription, it is nil for delta subscriptions.
+	Actions *ActionsReq
+	// Deltas is the request for a delta subscription, it is nil for action subscriptions.
+	Deltas *DeltasReq
+
+	results chan HyperionResponse
+	closed  bool
+	mode    ResponseMode
+
+	ackID      uint64
+	acked      chan error
+	waiting    bool
+	startBlock uint32
+	original   []byte // the request as made, before StartFrom was changed to resume
+
+	block  uint32          // last block delivered
+	seq    uint64          // last action global sequence delivered
+	keys   map[string]bool // deltas delivered in the last block
+	replay bool            // set after a resubscribe until the stream passes the last block delivered
+
+	recent     map[string]bool
+	recentRing []string
+	recentPos  int
+
+	predicate *Predicate
+	matched   atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+// request returns the socket.io event name and JSON body for the subscription, with StartFrom set to resume from the
+// last block delivered.
+func (s *Subscription) request() (event string, body []byte, err error) {
+	switch {
+	case s.Actions != nil:
+		req := *s.Actions
+		req.StartFrom = s.startFrom()
+		body, err = req.ToJson()
+		return "action_stream_request", body, err
+	case s.Deltas != nil:
+		req := *s.Deltas
+		req.StartFrom = s.startFrom()
+		body, err = req.ToJson()
+		return "delta_stream_request", body, err
+	}
+	return "", nil, UnknownTypeError{}
+}
+
+// startFrom is the original StartFrom of the request until a trace has been delivered, and then the last block seen.
+// The last block is requested again since not every trace within it is guaranteed to have been delivered.
+func (s *Subscription) startFrom() interface{} {
+	if s.block > 0 {
+		return int64(s.block)
+	}
+	if s.Actions != nil {
+		return s.Actions.StartFrom
+	}
+	return s.Deltas.StartFrom
+}
+
+// sameRequest reports whether two subscriptions were made with the same request, ignoring where a subscription has
+// since resumed from.
+func (s *Subscription) sameRequest(o *Subscription) bool {
+	return (s.Actions == nil) == (o.Actions == nil) && string(s.original) == string(o.original)
+}
+
+// matches reports whether a trace satisfies the subscription's request.
+func (s *Subscription) matches(resp HyperionResponse) bool {
+	switch r := resp.(type) {
+	case *ActionTrace:
+		if s.Actions == nil {
+			return false
+		}
+		return s.Actions.matches(r)
+	case *DeltaTrace:
+		if s.Deltas == nil {
+			return false
+		}
+		return s.Deltas.matches(r)
+	}
+	return false
+}
+
+// track records the position of a trace that is about to be delivered, returning false if it was already delivered,
+// either because it was replayed after a reconnect or because Hyperion sent it once for each overlapping request.
+func (s *Subscription) track(resp HyperionResponse) bool {
+	var block uint32
+	var key string
+	switch r := resp.(type) {
+	case *ActionTrace:
+		if s.replay && r.GlobalSequence <= s.seq {
+			return false
+		}
+		key = fmt.Sprintf("%d", r.GlobalSequence)
+		if s.seen(key) {
+			return false
+		}
+		if r.GlobalSequence > s.seq {
+			s.seq = r.GlobalSequence
+		}
+		block = r.BlockNum
+	case *DeltaTrace:
+		key = fmt.Sprintf("%d/%s/%s/%s/%s/%v", r.BlockNum, r.Code, r.Scope, r.Table, r.PrimaryKey, r.Present)
+		if s.replay && (r.BlockNum < s.block || (r.BlockNum == s.block && s.keys[key])) {
+			return false
+		}
+		if s.seen(key) {
+			return false
+		}
+		block = r.BlockNum
+	default:
+		return true
+	}
+
+	if block > s.block {
+		s.replay = false
+		s.block = block
+		s.keys = make(map[string]bool)
+	}
+	if resp.Type() == RespDeltaType && block == s.block {
+		if s.keys == nil {
+			s.keys = make(map[string]bool)
+		}
+		s.keys[key] = true
+	}
+	return true
+}
+
+// caughtUp records the mode of a delivered trace, returning true for the first live trace since the subscription was
+// sent, which is when Hyperion has finished replaying history.
+func (s *Subscription) caughtUp(resp HyperionResponse) bool {
+	was := s.mode
+	if mode := resp.Mode(); mode != "" {
+		s.mode = mode
+	}
+	return s.mode == RespModeLive && was != RespModeLive
+}
+
+// seen remembers the identity of a recently delivered trace, returning true if it was already present.
+func (s *Subscription) seen(key string) bool {
+	if s.recent == nil {
+		s.recent = make(map[string]bool)
+		s.recentRing = make([]string, recentSize)
+	}
+	if s.recent[key] {
+		return true
+	}
+	delete(s.recent, s.recentRing[s.recentPos])
+	s.recentRing[s.recentPos] = key
+	s.recentPos = (s.recentPos + 1) % recentSize
+	s.recent[key] = true
+	return false
+}
+
+// matches reports whether an action trace satisfies the request, combining the filters according to FilterOp. Filters
+// on fields other than act.data and act.authorization can't be evaluated locally and are assumed to match.
+func (ar *ActionsReq) matches(a *ActionTrace) bool {
+	if !nameMatches(string(ar.Contract), string(a.Act.Account)) || !nameMatches(string(ar.Action), string(a.Act.Name)) {
+		return false
+	}
+	if ar.Account != "" && ar.Account != "*" {
+		notified := false
+		for _, n := range a.Notified {
+			if n == ar.Account {
+				notified = true
+				break
+			}
+		}
+		for _, r := range a.Receipts {
+			if r.Receiver == ar.Account {
+				notified = true
+				break
+			}
+		}
+		if !notified {
+			return false
+		}
+	}
+	if ar.FilterOp == FilterOr && len(ar.Filters) > 0 {
+		for _, f := range ar.Filters {
+			if f != nil && f.matches(a) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, f := range ar.Filters {
+		if f == nil || !f.matches(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches evaluates the filter against an action trace.
+func (f *ReqFilter) matches(a *ActionTrace) bool {
+	switch {
+	case strings.HasPrefix(f.Field, "act.data."):
+		var v interface{} = a.Act.Data
+		for _, k := range strings.Split(strings.TrimPrefix(f.Field, "act.data."), ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			v = m[k]
+		}
+		if n, ok := v.(float64); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64) == f.Value
+		}
+		return v != nil && fmt.Sprint(v) == f.Value
+	case f.Field == "act.authorization.actor":
+		for _, auth := range a.Act.Authorization {
+			if string(auth.Actor) == f.Value {
+				return true
+			}
+		}
+		return false
+	case f.Field == "act.authorization.permission":
+		for _, auth := range a.Act.Authorization {
+			if string(auth.Permission) == f.Value {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matches reports whether a delta trace satisfies the request.
+func (dr *DeltasReq) matches(d *DeltaTrace) bool {
+	return nameMatches(string(dr.Code), string(d.Code)) &&
+		nameMatches(string(dr.Table), string(d.Table)) &&
+		nameMatches(string(dr.Scope), string(d.Scope)) &&
+		nameMatches(string(dr.Payer), string(d.Payer))
+}
+
+// nameMatches treats an empty or wildcard request field as matching anything.
+func nameMatches(want string, got string) bool {
+	return want == "" || want == "*" || want == got
+}
@@ -0,0 +1,210 @@
+package stream
+
+import (
+	"context"
+	"github.com/eoscanada/eos-go"
+	"testing"
+)
+
+func TestSubscriptionTrackDeltas(t *testing.T) {
+	s := &Subscription{Deltas: NewDeltasReq("a", "b", "c", "")}
+	if !s.track(&DeltaTrace{BlockNum: 5, PrimaryKey: "1"}) {
+		t.Error("first delta should be delivered")
+	}
+	if s.startFrom() != int64(5) {
+		t.Errorf("expected resume from block 5, got %v", s.startFrom())
+	}
+	s.replay = true
+	if s.track(&DeltaTrace{BlockNum: 5, PrimaryKey: "1"}) {
+		t.Error("replayed delta should be discarded")
+	}
+	if !s.track(&DeltaTrace{BlockNum: 5, PrimaryKey: "2"}) {
+		t.Error("undelivered delta in the resumed block should be delivered")
+	}
+	if !s.track(&DeltaTrace{BlockNum: 6, PrimaryKey: "1"}) || s.replay {
+		t.Error("replay should end once the stream passes the resumed block")
+	}
+}
+
+func TestSubscriptionTrackBlockZero(t *testing.T) {
+	s := &Subscription{Deltas: NewDeltasReq("a", "b", "", "")}
+	if !s.track(&DeltaTrace{Code: "a", Table: "b"}) {
+		t.Error("a delta without a block number should be delivered")
+	}
+	if s.track(&DeltaTrace{Code: "a", Table: "b"}) {
+		t.Error("duplicate delta should be discarded")
+	}
+}
+
+func TestSubscriptionTrackDuplicates(t *testing.T) {
+	s := &Subscription{Actions: NewActionsReq("a", "", "")}
+	if !s.track(&ActionTrace{BlockNum: 5, GlobalSequence: 2}) {
+		t.Error("first action should be delivered")
+	}
+	if !s.track(&ActionTrace{BlockNum: 5, GlobalSequence: 1}) {
+		t.Error("out of order action should be delivered")
+	}
+	if s.track(&ActionTrace{BlockNum: 5, GlobalSequence: 2}) {
+		t.Error("duplicate action should be discarded")
+	}
+}
+
+func TestActionsReqMatches(t *testing.T) {
+	a := &ActionTrace{Notified: []eos.AccountName{"bob"}}
+	a.Act.Account = "eosio.token"
+	a.Act.Name = "transfer"
+	a.Act.Data = map[string]interface{}{"to": "bob", "amount": float64(1099512961385)}
+
+	for _, tc := range []struct {
+		req  *ActionsReq
+		want bool
+	}{
+		{NewActionsReq("eosio.token", "", ""), true},
+		{NewActionsReq("eosio.token", "", "*"), true},
+		{NewActionsReq("eosio.token", "bob", "transfer"), true},
+		{NewActionsReq("eosio.token", "alice", "transfer"), false},
+		{NewActionsReq("eosio.token", "", "issue"), false},
+		{NewActionsReq("m.federation", "", "transfer"), false},
+	} {
+		if got := tc.req.matches(a); got != tc.want {
+			t.Errorf("%s/%s/%s: expected %v", tc.req.Contract, tc.req.Account, tc.req.Action, tc.want)
+		}
+	}
+
+	req := NewActionsReq("eosio.token", "", "transfer")
+	req.AddFilter(&ReqFilter{Field: "act.data.to", Value: "bob"})
+	req.AddFilter(&ReqFilter{Field: "act.data.amount", Value: "1099512961385"})
+	if !req.matches(a) {
+		t.Error("filters should match")
+	}
+	req.AddFilter(&ReqFilter{Field: "act.data.to", Value: "alice"})
+	if req.matches(a) {
+		t.Error("filter should not match")
+	}
+}
+
+func TestDeltasReqMatches(t *testing.T) {
+	d := &DeltaTrace{Code: "eosio.token", Scope: "bob", Table: "accounts"}
+	if !NewDeltasReq("eosio.token", "accounts", "bob", "").matches(d) {
+		t.Error("delta should match")
+	}
+	if NewDeltasReq("eosio.token", "accounts", "", "").matches(d) {
+		t.Error("scope defaults to the code and should not match")
+	}
+	if !NewDeltasReq("eosio.token", "*", "*", "").matches(d) {
+		t.Error("wildcards should match")
+	}
+}
+
+func TestMultipleSubscriptions(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	actions := make(chan HyperionResponse)
+	as, err := c.SubscribeActions(context.Background(), NewActionsReq("eosio.token", "", "transfer"), actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas := make(chan HyperionResponse)
+	ds, err := c.SubscribeDeltas(context.Background(), NewDeltasReq("eosio.token", "accounts", "", ""), deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if as.ID == ds.ID {
+		t.Error("subscriptions should have unique IDs")
+	}
+	if _, err = c.SubscribeDeltas(context.Background(), NewDeltasReq("eosio.token", "accounts", "", ""), deltas); err == nil {
+		t.Error("expected BusyError for a duplicate request")
+	}
+	fc.expectRequest(t, "action_stream_request")
+	fc.expectRequest(t, "delta_stream_request")
+
+	fc.send(t, deltaFrame(t, 10, "1"))
+	if r := nextResult(t, deltas); r.Type() != RespDeltaType {
+		t.Error("expected delta on the delta subscription")
+	}
+	fc.send(t, actionFrame(t, 10, 100))
+	if r := nextResult(t, actions); r.Type() != RespActionType {
+		t.Error("expected action on the action subscription")
+	}
+
+	c.Unsubscribe(as)
+	fc.send(t, actionFrame(t, 11, 101))
+	fc.send(t, deltaFrame(t, 11, "1"))
+	nextResult(t, deltas)
+	select {
+	case <-actions:
+		t.Error("unsubscribed channel received a trace")
+	case <-results:
+		t.Error("unsubscribed trace should not be sent to the client results")
+	default:
+	}
+}
+
+func TestBusyAfterDelivery(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != nil {
+		t.Fatal(err)
+	}
+	fc.expectRequest(t, "action_stream_request")
+	fc.send(t, actionFrame(t, 10, 100))
+	nextResult(t, results)
+
+	// the subscription now resumes from block 10, but it is still the same request:
+	if err = c.StreamActions(NewActionsReq("eosio.token", "", "transfer")); err != (BusyError{}) {
+		t.Errorf("expected BusyError for a duplicate request after a delivery, got %v", err)
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errors := make(chan error, 16)
+	live := make(chan *Subscription, 4)
+	c, err := NewClient(f.url(), results, errors, WithLiveHandler(func(s *Subscription) {
+		live <- s
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+	sub, err := c.SubscribeDeltas(context.Background(), NewDeltasReq("eosio.token", "accounts", "", ""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, traceFrame(t, "delta_trace", RespModeHist, &DeltaTrace{Code: "eosio.token", Scope: "eosio.token", Table: "accounts", BlockNum: 1}))
+	if r := nextResult(t, results); r.Mode() != RespModeHist {
+		t.Error("expected history trace")
+	}
+	if len(live) != 0 {
+		t.Error("live handler called during history")
+	}
+	fc.send(t, deltaFrame(t, 2, "1"))
+	nextResult(t, results)
+	fc.send(t, deltaFrame(t, 3, "1"))
+	nextResult(t, results)
+	if len(live) != 1 {
+		t.Fatalf("expected live handler to be called once, got %d", len(live))
+	}
+	if s := <-live; s != sub {
+		t.Error("live handler called with the wrong subscription")
+	}
+}
@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedAction is an action trace with Act.Data decoded into T.
+type TypedAction[T any] struct {
+	*ActionTrace
+	Data T
+}
+
+// TypedDelta is a delta trace with the table row decoded into T. Data shadows DeltaTrace.Data, which is still
+// available as TypedDelta.DeltaTrace.Data.
+type TypedDelta[T any] struct {
+	*DeltaTrace
+	Data T
+}
+
+// Subscribe sends an action stream request like Client.SubscribeActions, and calls handler with each matching trace
+// decoded into T. The handler is called from a single goroutine, in the order the traces are delivered.
+//
+// A trace whose data does not fit T is reported over the Client's errors as a DataError and skipped. If the handler
+// returns an error it is reported as a HandlerError and the Subscription is unsubscribed. Fork events are not passed
+// to the handler, see WithIrreversibleOnly.
+func Subscribe[T any](ctx context.Context, c *Client, req *ActionsReq, handler func(*TypedAction[T]) error) (*Subscription, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return subscribeTyped(ctx, c, &Subscription{Actions: req}, func(resp HyperionResponse) error {
+		a, err := resp.Action()
+		if err != nil {
+			return nil
+		}
+		typed := &TypedAction[T]{ActionTrace: a}
+		if err = a.DecodeData(&typed.Data); err != nil {
+			c.report(err)
+			return nil
+		}
+		return handler(typed)
+	})
+}
+
+// SubscribeTable sends a delta stream request like Client.SubscribeDeltas, and calls handler with each matching
+// table update decoded into T, see Subscribe.
+func SubscribeTable[T any](ctx context.Context, c *Client, req *DeltasReq, handler func(*TypedDelta[T]) error) (*Subscription, error) {
+	return subscribeTyped(ctx, c, &Subscription{Deltas: req}, func(resp HyperionResponse) error {
+		d, err := resp.Delta()
+		if err != nil {
+			return nil
+		}
+		typed := &TypedDelta[T]{DeltaTrace: d}
+		if err = d.DecodeData(&typed.Data); err != nil {
+			c.report(err)
+			return nil
+		}
+		return handler(typed)
+	})
+}
+
+// subscribeTyped subscribes with a channel of its own, and passes everything sent over it to handle until the Client
+// is cancelled. Traces are still read after the handler fails so that delivery to other subscriptions never blocks.
+func subscribeTyped(ctx context.Context, c *Client, s *Subscription, handle func(HyperionResponse) error) (*Subscription, error) {
+	s.results = make(chan HyperionResponse)
+	s, err := c.subscribe(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	c.goroutine(func() {
+		failed := false
+		for {
+			select {
+			case <-c.Ctx.Done():
+				return
+			case resp := <-s.results:
+				if failed {
+					continue
+				}
+				if err := handle(resp); err != nil {
+					failed = true
+					c.Unsubscribe(s)
+					c.report(HandlerError{Subscription: s.ID, Err: err})
+				}
+			}
+		}
+	})
+	return s, nil
+}
+
+// HandlerError is reported when the handler passed to Subscribe or SubscribeTable returns an error.
+type HandlerError struct {
+	Subscription uint64
+	Err          error
+}
+
+// Error satisfies the error interface
+func (he HandlerError) Error() string {
+	return fmt.Sprintf("handler for subscription %d failed: %v", he.Subscription, he.Err)
+}
+
+// Unwrap returns the handler's error
+func (he HandlerError) Unwrap() error {
+	return he.Err
+}
@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"github.com/eoscanada/eos-go"
+	"testing"
+	"time"
+)
+
+type logMine struct {
+	Miner      eos.AccountName `json:"miner"`
+	Bounty     eos.Asset       `json:"bounty"`
+	PlanetName eos.Name        `json:"planet_name"`
+	LandId     eos.Uint64      `json:"land_id"`
+}
+
+// logMineFrame is a logmine action trace for the given global sequence.
+func logMineFrame(t *testing.T, seq uint64, bounty string) string {
+	t.Helper()
+	a := &ActionTrace{BlockNum: 1, GlobalSequence: seq}
+	a.Act.Account = "m.federation"
+	a.Act.Name = "logmine"
+	a.Act.Data = map[string]interface{}{
+		"miner":       "4hhqy.wam",
+		"bounty":      bounty,
+		"planet_name": "magor.world",
+		"land_id":     "1099512960752",
+	}
+	return traceFrame(t, "action_trace", RespModeLive, a)
+}
+
+func TestSubscribe(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	mined := make(chan *TypedAction[logMine], 1)
+	_, err = Subscribe(context.Background(), c, NewActionsReq("m.federation", "", "logmine"), func(a *TypedAction[logMine]) error {
+		mined <- a
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, logMineFrame(t, 1, "not an asset"))
+	fc.send(t, logMineFrame(t, 2, "4.2301 TLM"))
+	select {
+	case err = <-errs:
+		if !errors.As(err, new(DataError)) {
+			t.Errorf("expected a DataError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a DataError")
+	}
+	select {
+	case a := <-mined:
+		if a.GlobalSequence != 2 || a.Data.Miner != "4hhqy.wam" || a.Data.LandId != 1099512960752 {
+			t.Errorf("unexpected action: %d %+v", a.GlobalSequence, a.Data)
+		}
+		if a.Data.Bounty.Amount != 42301 || a.Data.Bounty.Symbol.Symbol != "TLM" {
+			t.Errorf("unexpected bounty: %v", a.Data.Bounty)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the handler")
+	}
+}
+
+func TestSubscribeHandlerError(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	calls := make(chan uint64, 4)
+	failure := errors.New("failed")
+	s, err := Subscribe(context.Background(), c, NewActionsReq("m.federation", "", "logmine"), func(a *TypedAction[logMine]) error {
+		calls <- a.GlobalSequence
+		return failure
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, logMineFrame(t, 1, "1.0000 TLM"))
+	select {
+	case err = <-errs:
+		var handlerErr HandlerError
+		if !errors.As(err, &handlerErr) || handlerErr.Subscription != s.ID || !errors.Is(err, failure) {
+			t.Errorf("expected a HandlerError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a HandlerError")
+	}
+
+	// once unsubscribed the handler isn't called, and other traces are still delivered:
+	fc.send(t, logMineFrame(t, 2, "1.0000 TLM"))
+	fc.send(t, actionFrame(t, 1, 3))
+	if _, err = nextResult(t, results).Action(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("expected the handler to be called once, got %d", len(calls))
+	}
+}
+
+func TestSubscribeTable(t *testing.T) {
+	f := newFakeHyperion(t)
+	results := make(chan HyperionResponse)
+	errs := make(chan error, 16)
+	c, err := NewClient(f.url(), results, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fc := f.accept(t)
+
+	type account struct {
+		Balance eos.Asset `json:"balance"`
+	}
+	rows := make(chan *TypedDelta[account], 1)
+	_, err = SubscribeTable(context.Background(), c, NewDeltasReq("eosio.token", "accounts", "bob", ""), func(d *TypedDelta[account]) error {
+		rows <- d
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send(t, traceFrame(t, "delta_trace", RespModeLive, &DeltaTrace{
+		Code:       "eosio.token",
+		Scope:      "bob",
+		Table:      "accounts",
+		PrimaryKey: "5459781",
+		BlockNum:   1,
+		Present:    true,
+		Data:       map[string]interface{}{"balance": "2.5000 EOS"},
+	}))
+	select {
+	case d := <-rows:
+		if d.Scope != "bob" || d.Data.Balance.Amount != 25000 {
+			t.Errorf("unexpected row: %s %v", d.Scope, d.Data.Balance)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the handler")
+	}
+}